@@ -0,0 +1,247 @@
+package tre
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Type returns the type of the node p.
+func (p *Parsed) Type() ParseType {
+	return p.typ
+}
+
+// Left returns the operand of a repetition or capture group, or the
+// left operand of a concatenation or alternation. It is nil for other nodes.
+func (p *Parsed) Left() *Parsed {
+	return p.left
+}
+
+// Right returns the right operand of a concatenation or alternation,
+// or nil for other nodes.
+func (p *Parsed) Right() *Parsed {
+	return p.right
+}
+
+// Ranges returns a copy of the characters matched by a ParseClass node.
+func (p *Parsed) Ranges() Ranges {
+	return slices.Clone(p.class)
+}
+
+// Min returns the minimum count of a ParseRepeat node.
+func (p *Parsed) Min() int {
+	return p.min
+}
+
+// Max returns the maximum count of a ParseRepeat node, or -1 if it is unbounded.
+func (p *Parsed) Max() int {
+	return p.max
+}
+
+// Lazy returns true if p is a lazy repetition.
+func (p *Parsed) Lazy() bool {
+	return p.lazy
+}
+
+// CapNum returns the group number of a ParseCap node.
+func (p *Parsed) CapNum() int {
+	return p.capNum
+}
+
+// Name returns the name of a ParseCap node, or "" if the group is not named.
+func (p *Parsed) Name() string {
+	return p.name
+}
+
+// numberCaps returns p with its capture groups numbered after *next in the
+// order of their opening parentheses, and its classes listing the groups
+// that enclose them in caps, like the parser numbers them.
+// Subtrees that are already numbered this way are shared rather than copied.
+func numberCaps(p *Parsed, next *int, caps []int) *Parsed {
+	q := *p
+	switch p.typ {
+	case ParseClass:
+		q.caps = caps
+	case ParseCap:
+		*next++
+		q.capNum = *next
+		caps = append(slices.Clone(caps), q.capNum)
+	}
+	if p.left != nil {
+		q.left = numberCaps(p.left, next, caps)
+	}
+	if p.right != nil {
+		q.right = numberCaps(p.right, next, caps)
+	}
+
+	if q.left == p.left && q.right == p.right && q.capNum == p.capNum && slices.Equal(q.caps, p.caps) {
+		return p
+	}
+	return &q
+}
+
+// renumber returns p with its capture groups numbered from 1.
+// It panics if two groups have the same name.
+func renumber(p *Parsed) *Parsed {
+	names := make(map[string]struct{})
+	Walk(p, func(p *Parsed) bool {
+		if p.typ == ParseCap && p.name != "" {
+			if _, ok := names[p.name]; ok {
+				panic(fmt.Errorf("duplicate group name %q", p.name))
+			}
+			names[p.name] = struct{}{}
+		}
+		return true
+	})
+
+	next := 0
+	return numberCaps(p, &next, nil)
+}
+
+// CharClass returns a node that matches any one character in rs.
+func CharClass(rs Ranges) *Parsed {
+	return &Parsed{typ: ParseClass, class: slices.Clone(rs)}
+}
+
+// Literal returns a node that matches the string s.
+// It panics if s is empty.
+func Literal(s string) *Parsed {
+	var res []*Parsed
+	for _, ch := range s {
+		res = append(res, &Parsed{typ: ParseClass, class: newRange1(ch)})
+	}
+	return Concat(res...)
+}
+
+// Any returns a node that matches any character, like ".".
+func Any() *Parsed {
+	return &Parsed{typ: ParseClass, class: FullRanges()}
+}
+
+// Begin returns a node that matches the start of the input, like "^".
+func Begin() *Parsed {
+	return &Parsed{typ: ParseBegin}
+}
+
+// End returns a node that matches the end of the input, like "$".
+func End() *Parsed {
+	return &Parsed{typ: ParseEnd}
+}
+
+// Concat returns a node that matches res in sequence.
+// It panics if res is empty.
+func Concat(res ...*Parsed) *Parsed {
+	return renumber(joinRight(ParseConcat, res))
+}
+
+// Alt returns a node that matches any one of res, preferring earlier ones.
+// It panics if res is empty.
+func Alt(res ...*Parsed) *Parsed {
+	return renumber(joinRight(ParseAlt, res))
+}
+
+// joinRight joins res with nodes of type typ nested to the right,
+// as the parser nests them.
+func joinRight(typ ParseType, res []*Parsed) *Parsed {
+	if len(res) == 0 {
+		panic(fmt.Errorf("%v of nothing", typ))
+	}
+	re := res[len(res)-1]
+	for idx := len(res) - 2; idx >= 0; idx-- {
+		re = &Parsed{typ: typ, left: res[idx], right: re}
+	}
+	return re
+}
+
+// Star returns a node that matches re zero or more times, like "re*".
+func Star(re *Parsed) *Parsed {
+	return &Parsed{typ: ParseStar, left: re}
+}
+
+// Plus returns a node that matches re one or more times, like "re+".
+func Plus(re *Parsed) *Parsed {
+	return &Parsed{typ: ParsePlus, left: re}
+}
+
+// Opt returns a node that matches re zero or one times, like "re?".
+func Opt(re *Parsed) *Parsed {
+	return &Parsed{typ: ParseOpt, left: re}
+}
+
+// Repeat returns a node that matches re from min to max times, like "re{min,max}".
+// A max of -1 is unbounded. It panics if the range is empty, or if the
+// repetition expands to more than MaxExpansion states.
+func Repeat(re *Parsed, min, max int) *Parsed {
+	if min < 0 || max < -1 || (max >= 0 && max < min) {
+		panic(fmt.Errorf("repeat range {%d,%d} is empty", min, max))
+	}
+	rep := &Parsed{typ: ParseRepeat, left: re, min: min, max: max}
+	if rep.size() > MaxExpansion {
+		panic(fmt.Errorf("repetition expands to more than %d states", MaxExpansion))
+	}
+	return rep
+}
+
+// Lazy returns a copy of the repetition re that prefers fewer repeats, like "re*?".
+// It panics if re is not a repetition.
+func Lazy(re *Parsed) *Parsed {
+	if !re.isRepetition() {
+		panic(fmt.Errorf("%v is not a repetition", re.typ))
+	}
+	lazy := *re
+	lazy.lazy = true
+	return &lazy
+}
+
+// Cap returns a capture group for re with the given name, which may be empty.
+// Groups are numbered in the order of their opening parentheses,
+// so the groups of re are numbered after it.
+// It panics if name is not a valid group name.
+func Cap(re *Parsed, name string) *Parsed {
+	for idx, ch := range []rune(name) {
+		if !isGroupNameRune(ch, idx == 0) {
+			panic(fmt.Errorf("bad group name %q", name))
+		}
+	}
+	return renumber(&Parsed{typ: ParseCap, left: re, name: name})
+}
+
+// Walk calls f for each node of p in depth first order, starting with p.
+// The operands of a node are skipped if f returns false for it.
+func Walk(p *Parsed, f func(*Parsed) bool) {
+	if !f(p) {
+		return
+	}
+	if p.left != nil {
+		Walk(p.left, f)
+	}
+	if p.right != nil {
+		Walk(p.right, f)
+	}
+}
+
+// Rewrite returns a copy of p where each node is replaced by the result of f,
+// without modifying p. The operands of a node are rewritten before f is
+// called for it, so f sees them already rewritten. To leave a node unchanged
+// f returns it or nil. The capture groups of the result are renumbered.
+// It panics if the result has two groups with the same name.
+func Rewrite(p *Parsed, f func(*Parsed) *Parsed) *Parsed {
+	return renumber(rewrite(p, f))
+}
+
+func rewrite(p *Parsed, f func(*Parsed) *Parsed) *Parsed {
+	q := *p
+	if p.left != nil {
+		q.left = rewrite(p.left, f)
+	}
+	if p.right != nil {
+		q.right = rewrite(p.right, f)
+	}
+	node := &q
+	if q.left == p.left && q.right == p.right {
+		node = p
+	}
+	if res := f(node); res != nil {
+		return res
+	}
+	return node
+}
@@ -0,0 +1,157 @@
+package tre
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/alecthomas/assert"
+)
+
+func TestConstructors(t *testing.T) {
+	var digits Ranges
+	digits.Add('0', '7')
+
+	tests := []struct {
+		re   *Parsed
+		want string
+	}{
+		{Literal("abc"), "abc"},
+		{Concat(Begin(), Literal("a"), End()), "^a$"},
+		{Alt(Literal("ab"), Literal("c"), Any()), "ab|c|."},
+		{Concat(Alt(Literal("a"), Literal("b")), Literal("c")), "(a|b)c"},
+		{Star(Literal("ab")), "(ab)*"},
+		{Plus(CharClass(digits)), "[0-7]+"},
+		{Lazy(Opt(Literal("a"))), "a??"},
+		{Repeat(Literal("a"), 2, -1), "a{2,}"},
+		{Lazy(Repeat(Literal("a"), 1, 3)), "a{1,3}?"},
+		{Concat(Cap(Literal("a"), "x"), Cap(Cap(Literal("b"), ""), "y")), "(?<x>a)(?<y>(?b))"},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.re.String(), test.want)
+		p, err := Parse(test.want)
+		assert.NoError(t, err)
+		assert.Equal(t, test.re, p, test.want)
+	}
+}
+
+func TestConstructorsPanic(t *testing.T) {
+	assert.Panics(t, func() { Concat() })
+	assert.Panics(t, func() { Alt() })
+	assert.Panics(t, func() { Literal("") })
+	assert.Panics(t, func() { Repeat(Literal("a"), 2, 1) })
+	assert.Panics(t, func() { Repeat(Literal("a"), -1, 1) })
+	assert.Panics(t, func() { Repeat(Literal("a"), 0, MaxExpansion+1) })
+	assert.Panics(t, func() { Lazy(Literal("a")) })
+	assert.Panics(t, func() { Cap(Literal("a"), "1x") })
+	assert.Panics(t, func() { Concat(Cap(Literal("a"), "x"), Cap(Literal("b"), "x")) })
+}
+
+func TestCapNumbering(t *testing.T) {
+	a := Cap(Literal("a"), "")
+	re := Concat(a, Star(Cap(Concat(a, Literal("b")), "")))
+	assert.Equal(t, re.String(), "(?a)(?(?a)b)*")
+	assert.Equal(t, a.CapNum(), 1, "arguments are not modified")
+
+	nfa := MakeNfa(re)
+	assert.Equal(t, nfa.SubmatchIndex("aabab"), []int{0, 5, 0, 1, 3, 5, 3, 4})
+	groups, ok := nfa.Match("aabab")
+	assert.True(t, ok)
+	assert.Equal(t, groups, []string{"a", "abab", "aa"})
+}
+
+func TestAccessors(t *testing.T) {
+	p, err := Parse("(?<n>[a-c]){2,3}?|$")
+	assert.NoError(t, err)
+	assert.Equal(t, p.Type(), ParseAlt)
+	assert.Equal(t, p.Right().Type(), ParseEnd)
+
+	rep := p.Left()
+	assert.Equal(t, rep.Type(), ParseRepeat)
+	assert.Equal(t, rep.Min(), 2)
+	assert.Equal(t, rep.Max(), 3)
+	assert.True(t, rep.Lazy())
+	assert.Equal(t, rep.Right(), (*Parsed)(nil))
+
+	capture := rep.Left()
+	assert.Equal(t, capture.Type(), ParseCap)
+	assert.Equal(t, capture.CapNum(), 1)
+	assert.Equal(t, capture.Name(), "n")
+	assert.Equal(t, capture.Left().Ranges(), newRange('a', 'c'))
+}
+
+func TestWalk(t *testing.T) {
+	p, err := Parse("a(?b|c*)d")
+	assert.NoError(t, err)
+
+	var types []ParseType
+	Walk(p, func(p *Parsed) bool {
+		types = append(types, p.Type())
+		return p.Type() != ParseCap
+	})
+	assert.Equal(t, types, []ParseType{ParseConcat, ParseClass, ParseConcat, ParseCap, ParseClass})
+}
+
+func TestRewrite(t *testing.T) {
+	p, err := Parse("(?<x>a)b*(?c)|(?d)")
+	assert.NoError(t, err)
+	orig := p.String()
+
+	// make stars lazy.
+	lazy := Rewrite(p, func(p *Parsed) *Parsed {
+		if p.Type() == ParseStar {
+			return Lazy(p)
+		}
+		return p
+	})
+	assert.Equal(t, lazy.String(), "(?<x>a)b*?(?c)|(?d)")
+	assert.Equal(t, p.String(), orig)
+
+	// drop unnamed groups, renumbering the rest.
+	unnamed := Rewrite(p, func(p *Parsed) *Parsed {
+		if p.Type() == ParseCap && p.Name() == "" {
+			return p.Left()
+		}
+		return p
+	})
+	assert.Equal(t, unnamed.String(), "(?<x>a)b*c|d")
+	assert.Equal(t, MakeNfa(unnamed).SubexpNames(), []string{"", "x"})
+
+	// wrap every class in a group, numbered in order.
+	wrapped := Rewrite(p, func(p *Parsed) *Parsed {
+		if p.Type() == ParseClass {
+			return Cap(p, "")
+		}
+		return p
+	})
+	assert.Equal(t, wrapped.String(), "(?<x>(?a))(?b)*(?(?c))|(?(?d))")
+	assert.Equal(t, MakeNfa(wrapped).SubmatchIndex("abc"), []int{0, 3, 0, 1, 0, 1, 1, 2, 2, 3, 2, 3, -1, -1, -1, -1})
+
+	same := Rewrite(p, func(p *Parsed) *Parsed { return p })
+	assert.True(t, same == p)
+	same = Rewrite(p, func(p *Parsed) *Parsed { return nil })
+	assert.True(t, same == p)
+
+	// renaming every group to x gives duplicate names.
+	assert.Panics(t, func() {
+		Rewrite(p, func(p *Parsed) *Parsed {
+			if p.Type() == ParseCap {
+				return Cap(p.Left(), "x")
+			}
+			return p
+		})
+	})
+}
+
+func TestRenumberParsed(t *testing.T) {
+	// the parser numbers groups like renumber, so parsed trees are unchanged.
+	r := rand.New(rand.NewSource(1))
+	for range 10000 {
+		pat := randomString(r, "ab()?|*<n>", 1+r.Intn(12))
+		p, err := Parse(pat)
+		if err != nil {
+			continue
+		}
+		assert.True(t, renumber(p) == p, pat)
+	}
+}
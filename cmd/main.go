@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
 
@@ -26,22 +27,32 @@ func main() {
 	n, err := tre.Parse(s)
 	if err != nil {
 		fmt.Printf("error %v\n", err)
+		var perr *tre.ParseError
+		if errors.As(err, &perr) {
+			fmt.Printf("%s\n", perr.Caret())
+		}
 		return
 	}
 
 	fmt.Printf("parsed %s\n", s)
 	n.Print(1)
 	fmt.Printf("\n")
+	n = tre.Simplify(n)
+	fmt.Printf("simplified %s\n", n)
+	n.Print(1)
+	fmt.Printf("\n")
 	nfa := tre.MakeNfa(n)
 	nfa.Dot("main-nfa.dot", s)
 
-	groups, match := tre.MatchNfa(nfa, targ)
+	groups, match := nfa.Match(targ)
 	fmt.Printf("match is %v %v\n", match, groups)
 
 	dfa := tre.MakeDfa(nfa)
 	fmt.Printf("got dfa %v\n", dfa)
+	before, after := dfa.Minimize()
+	fmt.Printf("minimized dfa from %d to %d states\n", before, after)
 	dfa.Dot("main-dfa.dot", s)
 
-	groups, match = tre.MatchDfa(dfa, targ)
+	groups, match = dfa.Match(targ)
 	fmt.Printf("match is %v %v\n", match, groups)
 }
@@ -1,22 +1,34 @@
 package tre
 
 import (
+	"encoding/binary"
 	"fmt"
+	"io"
 	"os"
 	"slices"
 	"strings"
-	"unsafe"
 )
 
 type Edge struct {
-	class Ranges
-	next  *Dfa
+	class Class
+	next  *dfaState
+	ops   []tagOp // tagged DFAs only, one per item of next
 }
 
+type dfaState struct {
+	id        int  // assigned in breadth first order from the start state
+	accept    bool // accepting at the end of input
+	acceptMid bool // accepting with more input remaining
+	caps      []int
+	edges     []Edge
+	tags      *tags // tagged DFAs only
+}
+
+// Dfa is a DFA built by MakeDfa or MakeTaggedDfa from its start states.
 type Dfa struct {
-	accept bool
-	caps   []int
-	edges  []Edge
+	start    *dfaState
+	midStart *dfaState // start state for searches that don't begin at the start of input
+	groupNames
 }
 
 func (p *Dfa) Dot(fn, label string) {
@@ -32,121 +44,144 @@ func (p *Dfa) Dot(fn, label string) {
 		}
 		defer fp.Close()
 	}
+	p.WriteDot(fp, label)
+}
 
-	nextId := 0
-	ids := make(map[*Dfa]int)
-	ids[nil] = 999999 // in case something goes wrong
-	getId := func(p *Dfa) (int, bool) {
-		id, ok := ids[p]
-		if ok {
-			return id, ok
+// WriteDot writes the DFA p to w in graphviz format.
+// States are written in order of their ids.
+func (p *Dfa) WriteDot(w io.Writer, label string) {
+	fmt.Fprintf(w, "digraph G {\n")
+	fmt.Fprintf(w, "  graph [rankdir = LR, label=%q]\n", label)
+	for _, d := range p.states() {
+		lab := "accept"
+		if !d.accept {
+			lab = fmt.Sprintf("%d", d.id)
 		}
-		nextId++
-		ids[p] = nextId
-		return nextId, false
-	}
 
-	walk := func(p *Dfa) {}
-	walk = func(p *Dfa) {
-		id, ok := getId(p)
-		if ok {
-			return
+		if len(d.caps) > 0 {
+			fmt.Fprintf(w, "  node_%d [label = \"%v\\ncaps=%v\"]\n", d.id, lab, d.caps)
+		} else {
+			fmt.Fprintf(w, "  node_%d [label = \"%v\"]\n", d.id, lab)
 		}
 
-		lab := "accept"
-		if !p.accept {
-			lab = fmt.Sprintf("%d", id)
+		for _, edge := range d.edges {
+			if len(edge.ops) > 0 {
+				fmt.Fprintf(w, "  node_%d -> node_%d [label = \"%v %v\"]\n", d.id, edge.next.id, edge.class, edge.ops)
+			} else {
+				fmt.Fprintf(w, "  node_%d -> node_%d [label = \"%v\"]\n", d.id, edge.next.id, edge.class)
+			}
 		}
+	}
+	fmt.Fprintf(w, "}\n")
+}
 
-		if len(p.caps) > 0 {
-			fmt.Fprintf(fp, "  node_%d [label = \"%v\\ncaps=%v\"]\n", id, lab, p.caps)
-		} else {
-			fmt.Fprintf(fp, "  node_%d [label = \"%v\"]\n", id, lab)
+// states returns the states reachable from the start states of d
+// in breadth first order.
+func (d *Dfa) states() []*dfaState {
+	var l []*dfaState
+	seen := make(map[*dfaState]struct{})
+	add := func(d *dfaState) {
+		if _, ok := seen[d]; !ok && d != nil {
+			seen[d] = struct{}{}
+			l = append(l, d)
 		}
+	}
 
-		for _, edge := range p.edges {
-			walk(edge.next)
-		}
-		for _, edge := range p.edges {
-			fmt.Fprintf(fp, "  node_%d -> node_%d [label = \"%v\"]\n", id, ids[edge.next], edge.class)
+	add(d.start)
+	add(d.midStart)
+	for idx := 0; idx < len(l); idx++ {
+		for _, edge := range l[idx].edges {
+			add(edge.next)
 		}
 	}
-	fmt.Fprintf(fp, "digraph G {\n")
-	fmt.Fprintf(fp, "  graph [rankdir = LR, label=%q]\n", label)
-	walk(p)
-	fmt.Fprintf(fp, "}\n")
+	return l
 }
 
-type NfaSet struct {
-	set []*Nfa
-	dfa *Dfa
+// numberDfa numbers the states of d in breadth first order.
+func numberDfa(d *Dfa) {
+	for id, s := range d.states() {
+		s.id = id
+	}
 }
 
-func cmpNfa(a, b *Nfa) int {
-	pa := uintptr(unsafe.Pointer(a))
-	pb := uintptr(unsafe.Pointer(b))
-	return int(pa - pb)
+// nfaSets maps the keys of sets of NFA states to their DFA states.
+type nfaSets map[string]*dfaState
+
+func cmpNfa(a, b *nfaState) int {
+	return a.id - b.id
 }
 
-func sortNfas(ns []*Nfa) {
+func sortNfas(ns []*nfaState) {
 	slices.SortFunc(ns, cmpNfa)
 }
 
-func eqNfas(a, b []*Nfa) bool {
-	return slices.Equal(a, b)
+// nfaSetKey returns a key identifying a list of NFA states with caps and acceptance.
+func nfaSetKey(ns []*nfaState, caps []int, accept bool) string {
+	var b []byte
+	b = binary.AppendUvarint(b, uint64(len(ns)))
+	for _, n := range ns {
+		b = binary.AppendUvarint(b, uint64(n.id))
+	}
+	b = binary.AppendUvarint(b, uint64(len(caps)))
+	for _, c := range caps {
+		b = binary.AppendVarint(b, int64(c))
+	}
+	if accept {
+		b = append(b, 1)
+	}
+	return string(b)
 }
 
-// addNfaSet finds set in l, or adds a new entry for set to l.
-// It returns the updated list, the entry for s, and true if the item already existed, and false if it was newly created.
-func addNfaSet(l []NfaSet, set []*Nfa, caps []int) ([]NfaSet, *Dfa, bool) {
+// addNfaSet finds the DFA state for set in sets, or adds a new one.
+// The assertions in at hold at the position where set is reached.
+// It returns the DFA state, and true if it already existed, and false if it was newly created.
+func addNfaSet(sets nfaSets, set []*nfaState, caps []int, at anchors) (*dfaState, bool) {
 	sortNfas(set)
-
-	for _, state := range l {
-		if eqNfas(state.set, set) && slices.Equal(state.dfa.caps, caps) {
-			return l, state.dfa, true
-		}
+	accept := acceptsAt(set, at|atEnd)
+	key := nfaSetKey(set, caps, accept)
+	if dfa, ok := sets[key]; ok {
+		return dfa, true
 	}
 
-	dfa := &Dfa{accept: accepts(set), caps: caps}
-	l = append(l, NfaSet{set, dfa})
-	return l, dfa, false
-}
-
-func classInClasses(cs []Ranges, c Ranges) bool {
-	for _, c2 := range cs {
-		if slices.Equal(c2, c) {
-			return true
-		}
-	}
-	return false
+	dfa := &dfaState{accept: accept, acceptMid: accepts(set), caps: caps}
+	sets[key] = dfa
+	return dfa, false
 }
 
 // disjointClasses returns a list of non-overlapping character classes
 // accepted by the NFA states in ns.
-func disjointClasses(ns []*Nfa) []Ranges {
+func disjointClasses(ns []*nfaState) []Ranges {
 	var classes []Ranges
 	for _, n := range ns {
-		if n.accept || n.split {
-			continue
-		}
-
-		//fmt.Printf("class %v\n", n.class)
-		if len(classes) == 0 {
-			classes = append(classes, n.class)
+		if n.accept || n.split || n.begin || n.end || n.save {
 			continue
 		}
+		classes = append(classes, n.class.ranges)
+	}
+	return disjointRanges(classes)
+}
 
+// disjointRanges returns a list of non-overlapping character classes
+// that cover the same characters as cs, such that each class in cs is
+// a union of classes in the result.
+func disjointRanges(cs []Ranges) []Ranges {
+	var classes []Ranges
+	for _, c := range cs {
+		//fmt.Printf("class %v\n", c)
 		var newClasses []Ranges
+		rest := c // the part of c not covered by any class yet.
 		for _, class := range classes {
-			onlyA, both, onlyB := Diff(class, n.class)
-			for _, c := range []Ranges{onlyA, both, onlyB} {
+			onlyClass, both, _ := Diff(class, c)
+			_, _, rest = Diff(class, rest)
+			for _, c := range []Ranges{onlyClass, both} {
 				if len(c) > 0 {
-					if !classInClasses(newClasses, c) {
-						newClasses = append(newClasses, c)
-					}
+					newClasses = append(newClasses, c)
 				}
 			}
 		}
+		if len(rest) > 0 {
+			newClasses = append(newClasses, rest)
+		}
 		classes = newClasses
 	}
 	//fmt.Printf("  disjoint clases %v\n", classes)
@@ -154,25 +189,43 @@ func disjointClasses(ns []*Nfa) []Ranges {
 }
 
 func MakeDfa(n *Nfa) *Dfa {
-	var states []NfaSet
-	ns := advanceEpsilon(n) // follow epsilon edges from start
+	states := make(nfaSets)
 
-	states, dstart, _ := addNfaSet(states, ns, []int{})
+	// states are explored in breadth first order.
+	type work struct {
+		d  *dfaState
+		ns []*nfaState
+	}
+	var queue []work
+	addState := func(ns []*nfaState, caps []int, at anchors) *dfaState {
+		d, visited := addNfaSet(states, ns, caps, at)
+		if !visited {
+			queue = append(queue, work{d, ns})
+		}
+		return d
+	}
 
-	addEdge := func(d *Dfa, class Ranges, targ *Dfa) {
+	addEdge := func(d *dfaState, class Ranges, targ *dfaState) {
 		for n := range d.edges {
 			// if we already have an edge to targ
 			// just augment its class with the new class.
 			if d.edges[n].next == targ {
-				d.edges[n].class.AddRanges(class)
+				d.edges[n].class = d.edges[n].class.Union(class)
 				return
 			}
 		}
-		d.edges = append(d.edges, Edge{class: class, next: targ})
+		d.edges = append(d.edges, Edge{class: NewClass(class), next: targ})
 	}
 
-	explore := func(d *Dfa, ns []*Nfa) {}
-	explore = func(d *Dfa, ns []*Nfa) {
+	// searches starting past the start of input can't match begin assertions.
+	dfa := &Dfa{groupNames: n.groupNames}
+	dfa.start = addState(advanceEpsilon(n.start, atBegin), []int{}, atBegin)
+	dfa.midStart = addState(advanceEpsilon(n.start, 0), []int{}, 0)
+
+	for len(queue) > 0 {
+		d, ns := queue[0].d, queue[0].ns
+		queue = queue[1:]
+
 		// NOTE: some of the disjointed classes might still go to the same location.
 		// These get merged in addEdge.
 		for _, class := range disjointClasses(ns) {
@@ -181,34 +234,38 @@ func MakeDfa(n *Nfa) *Dfa {
 			if len(ns2) == 0 {
 				continue
 			}
-
-			var dtarg *Dfa
-			var visited bool
-			states, dtarg, visited = addNfaSet(states, ns2, caps)
-			addEdge(d, class, dtarg)
-			if !visited {
-				explore(dtarg, ns2)
-			}
+			addEdge(d, class, addState(ns2, caps, 0))
 		}
 	}
 
-	explore(dstart, ns)
-	return dstart
+	numberDfa(dfa)
+	return dfa
 }
 
-func matchChar(d *Dfa, ch rune) *Dfa {
-	for _, edge := range d.edges {
-		if edge.class.Contains(ch) {
-			return edge.next
+func matchEdge(d *dfaState, ch rune) *Edge {
+	for n := range d.edges {
+		if d.edges[n].class.Contains(ch) {
+			return &d.edges[n]
 		}
 	}
 	return nil
 }
 
+func matchChar(d *dfaState, ch rune) *dfaState {
+	if edge := matchEdge(d, ch); edge != nil {
+		return edge.next
+	}
+	return nil
+}
+
 type Matcher interface {
 	Match(s string) ([]string, bool)
 }
 
+type Finder interface {
+	FindIndex(s string) []int
+}
+
 func NewDfa(re string) (*Dfa, error) {
 	nfa, err := NewNfa(re)
 	if err != nil {
@@ -217,16 +274,49 @@ func NewDfa(re string) (*Dfa, error) {
 	return MakeDfa(nfa), nil
 }
 
+// dfaSearch runs a DFA in findLongest.
+type dfaSearch struct {
+	d *Dfa
+}
+
+func (ds dfaSearch) start(at anchors, add func(*dfaState) bool) {
+	if at&atBegin != 0 {
+		add(ds.d.start)
+	} else {
+		add(ds.d.midStart)
+	}
+}
+
+func (dfaSearch) step(d *dfaState, ch rune, add func(*dfaState) bool) {
+	if next := matchChar(d, ch); next != nil {
+		add(next)
+	}
+}
+
+func (dfaSearch) accepting(d *dfaState, at anchors) bool {
+	if at&atEnd != 0 {
+		return d.accept
+	}
+	return d.acceptMid
+}
+
+// FindIndex returns the byte offsets of the leftmost longest match of d in s,
+// or nil if there is no match. The match need not cover all of s.
+func (d *Dfa) FindIndex(s string) []int {
+	return findLongest(dfaSearch{d}, s)
+}
+
 func (d *Dfa) Match(s string) ([]string, bool) {
 	capGroups := make(map[int]*strings.Builder)
 	maxGroup := 0
+	state := d.start
 	for _, ch := range []rune(s) {
-		d = matchChar(d, ch)
-		if d == nil {
+		state = matchChar(state, ch)
+		if state == nil {
 			return nil, false
 		}
 
-		for _, capIdx := range d.caps {
+		for _, capIdx := range state.caps {
 			if _, ok := capGroups[capIdx]; !ok {
 				if capIdx > maxGroup {
 					maxGroup = capIdx
@@ -237,7 +327,7 @@ func (d *Dfa) Match(s string) ([]string, bool) {
 		}
 	}
 
-	if !d.accept {
+	if !state.accept {
 		return nil, false
 	}
 
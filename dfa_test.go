@@ -0,0 +1,23 @@
+package tre
+
+import (
+	"fmt"
+	"testing"
+)
+
+// BenchmarkMakeDfa builds DFAs for (a|b)*a(a|b){n}, which need 2^(n+1) states.
+func BenchmarkMakeDfa(b *testing.B) {
+	for _, n := range []int{6, 8, 10, 12, 14} {
+		pat := fmt.Sprintf("(a|b)*a(a|b){%d}", n)
+		nfa, err := NewNfa(pat)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		b.Run(fmt.Sprintf("states=%d", 1<<(n+1)), func(b *testing.B) {
+			for b.Loop() {
+				MakeDfa(nfa)
+			}
+		})
+	}
+}
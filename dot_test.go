@@ -0,0 +1,70 @@
+package tre
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alecthomas/assert"
+)
+
+var updateGolden = flag.Bool("update", false, "update golden files in testdata")
+
+// expectGolden compares got with the golden file testdata/name,
+// or writes it if the -update flag is set.
+func expectGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	fn := filepath.Join("testdata", name)
+	if *updateGolden {
+		assert.NoError(t, os.MkdirAll(filepath.Dir(fn), 0o755))
+		assert.NoError(t, os.WriteFile(fn, got, 0o644))
+		return
+	}
+
+	want, err := os.ReadFile(fn)
+	assert.NoError(t, err)
+	assert.Equal(t, string(got), string(want), fn)
+}
+
+func TestDotGolden(t *testing.T) {
+	tests := []struct {
+		name string
+		pat  string
+	}{
+		{"hello", "(hello|help)(a|b)*world"},
+		{"caps", "x(?a|b)*y"},
+		{"anchors", "^a{2,3}$"},
+		{"abb", "(a|b)*abb"},
+	}
+
+	dots := func(pat string) map[string][]byte {
+		out := make(map[string][]byte)
+		write := func(kind string, f func(*bytes.Buffer)) {
+			var buf bytes.Buffer
+			f(&buf)
+			out[kind] = buf.Bytes()
+		}
+
+		nfa, err := NewNfa(pat)
+		assert.NoError(t, err)
+		write("nfa", func(buf *bytes.Buffer) { nfa.WriteDot(buf, pat) })
+		dfa := MakeDfa(nfa)
+		write("dfa", func(buf *bytes.Buffer) { dfa.WriteDot(buf, pat) })
+		dfa.Minimize()
+		write("min", func(buf *bytes.Buffer) { dfa.WriteDot(buf, pat) })
+		tdfa := MakeTaggedDfa(nfa)
+		write("tdfa", func(buf *bytes.Buffer) { tdfa.WriteDot(buf, pat) })
+		return out
+	}
+
+	for _, test := range tests {
+		// building the same pattern twice gives identical output.
+		first, second := dots(test.pat), dots(test.pat)
+		for _, kind := range []string{"nfa", "dfa", "min", "tdfa"} {
+			assert.Equal(t, string(second[kind]), string(first[kind]))
+			expectGolden(t, filepath.Join("dot", test.name+"."+kind+".dot"), first[kind])
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package tre
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ErrorCode classifies a ParseError.
+type ErrorCode int
+
+//go:generate go run golang.org/x/tools/cmd/stringer -type=ErrorCode
+const (
+	ErrUnexpected   ErrorCode = iota // unexpected character
+	ErrExpected                      // a required character is missing
+	ErrBadEscape                     // unknown escape sequence
+	ErrBadCodePoint                  // malformed or out of range numeric escape
+	ErrBadClass                      // unknown or unterminated unicode or POSIX class
+	ErrEmptyRange                    // class range or repeat range is empty
+	ErrBadRepeat                     // malformed or too large counted repetition
+	ErrBadFlags                      // malformed flag group
+	ErrBadGroupName                  // missing, malformed or duplicate group name
+)
+
+// ParseError describes where and why a pattern failed to parse.
+type ParseError struct {
+	Code       ErrorCode
+	Msg        string
+	Pattern    string
+	Offset     int // rune offset of the error in Pattern
+	ByteOffset int // byte offset of the error in Pattern
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%d: %s", e.Offset, e.Msg)
+}
+
+// Caret returns the line of the pattern with the error,
+// and a line below it with a caret under the error.
+func (e *ParseError) Caret() string {
+	start := strings.LastIndexByte(e.Pattern[:e.ByteOffset], '\n') + 1
+	end := len(e.Pattern)
+	if n := strings.IndexByte(e.Pattern[e.ByteOffset:], '\n'); n >= 0 {
+		end = e.ByteOffset + n
+	}
+
+	// tabs are kept so the caret lines up with the pattern.
+	var pad strings.Builder
+	for _, ch := range e.Pattern[start:e.ByteOffset] {
+		if ch == '\t' {
+			pad.WriteRune('\t')
+		} else {
+			pad.WriteRune(' ')
+		}
+	}
+	return fmt.Sprintf("%s\n%s^", e.Pattern[start:end], pad.String())
+}
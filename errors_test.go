@@ -0,0 +1,116 @@
+package tre
+
+import (
+	"errors"
+	"math/rand"
+	"testing"
+
+	"github.com/alecthomas/assert"
+)
+
+func TestParseError(t *testing.T) {
+	tests := []struct {
+		pat        string
+		code       ErrorCode
+		offset     int
+		byteOffset int
+	}{
+		{"ab)", ErrExpected, 2, 2},
+		{"(ab", ErrExpected, 3, 3},
+		{"a|*", ErrUnexpected, 2, 2},
+		{"éé\\q", ErrBadEscape, 2, 4},
+		{"\\x{110000}", ErrBadCodePoint, 0, 0},
+		{"ü\\p{Klingon}", ErrBadClass, 1, 2},
+		{"[[:foo:]]", ErrBadClass, 1, 1},
+		{"x[z-a]", ErrEmptyRange, 2, 2},
+		{"a{3,2}", ErrEmptyRange, 1, 1},
+		{"a{1,100000}", ErrBadRepeat, 4, 4},
+		{"(?-)a", ErrBadFlags, 2, 2},
+		{"(?<a>x)(?<a>y)", ErrBadGroupName, 9, 9},
+	}
+
+	for _, test := range tests {
+		_, err := Parse(test.pat)
+		var perr *ParseError
+		assert.True(t, errors.As(err, &perr), test.pat)
+		assert.Equal(t, perr.Code, test.code, test.pat)
+		assert.Equal(t, perr.Offset, test.offset, test.pat)
+		assert.Equal(t, perr.ByteOffset, test.byteOffset, test.pat)
+		assert.Equal(t, perr.Pattern, test.pat)
+	}
+}
+
+func TestParseErrorCaret(t *testing.T) {
+	_, err := Parse("héllo|(wor\\ld")
+	var perr *ParseError
+	assert.True(t, errors.As(err, &perr))
+	assert.Equal(t, perr.Error(), "10: unexpected 'l' after \\")
+	assert.Equal(t, perr.Caret(), "héllo|(wor\\ld\n          ^")
+
+	// tabs in the pattern are kept in the caret line.
+	perr = &ParseError{Pattern: "a\tb)", Offset: 3, ByteOffset: 3}
+	assert.Equal(t, perr.Caret(), "a\tb)\n \t ^")
+
+	// only the line with the error is shown.
+	perr = &ParseError{Pattern: "ab\ncd\nef", Offset: 4, ByteOffset: 4}
+	assert.Equal(t, perr.Caret(), "cd\n ^")
+
+	// errors at the end of the pattern point past it.
+	_, err = Parse("(ab")
+	assert.True(t, errors.As(err, &perr))
+	assert.Equal(t, perr.Caret(), "(ab\n   ^")
+	assert.Equal(t, perr.Code.String(), "ErrExpected")
+}
+
+func TestParseRecover(t *testing.T) {
+	type perr struct {
+		code   ErrorCode
+		offset int
+	}
+	tests := []struct {
+		pat  string
+		want []perr
+	}{
+		{"a\\q|b\\z", []perr{{ErrBadEscape, 1}, {ErrBadEscape, 5}}},
+		{"(a|*b)c)d(e", []perr{{ErrUnexpected, 3}, {ErrExpected, 7}, {ErrExpected, 11}}},
+		{"[a-]x[z-a]y", []perr{{ErrUnexpected, 3}, {ErrEmptyRange, 6}}},
+		{"[\\q|x]\\z", []perr{{ErrBadEscape, 1}, {ErrBadEscape, 6}}},
+		{"a{3,2}b{x}c", []perr{{ErrEmptyRange, 1}, {ErrBadRepeat, 8}}},
+		{"(?<1>a)b\\q", []perr{{ErrBadGroupName, 3}, {ErrBadEscape, 8}}},
+		{"(?-)a\\q", []perr{{ErrBadFlags, 2}, {ErrBadEscape, 5}}},
+		{"(a\\q(b|c)d|\\z)", []perr{{ErrBadEscape, 2}, {ErrBadEscape, 11}}},
+		{"a)b)", []perr{{ErrExpected, 1}, {ErrExpected, 3}}},
+	}
+
+	for _, test := range tests {
+		p, errs := ParseRecover(test.pat, 0)
+		assert.Zero(t, p, test.pat)
+		var got []perr
+		for _, err := range errs {
+			got = append(got, perr{err.Code, err.Offset})
+		}
+		assert.Equal(t, got, test.want, test.pat)
+	}
+
+	p, errs := ParseRecover("(?i)a(?b|c)*", 0)
+	assert.Zero(t, errs)
+	want, err := Parse("(?i)a(?b|c)*")
+	assert.NoError(t, err)
+	assert.Equal(t, p, want)
+}
+
+func TestParseRecoverRandom(t *testing.T) {
+	// the first recovered error is the error that Parse stops at.
+	r := rand.New(rand.NewSource(1))
+	for range 5000 {
+		pat := randomString(r, "ab()|[]{}*?,1-\\q^:", r.Intn(10))
+		_, err := Parse(pat)
+		_, errs := ParseRecover(pat, 0)
+		if err == nil {
+			assert.Zero(t, errs, pat)
+			continue
+		}
+		assert.NotZero(t, errs, pat)
+		assert.Equal(t, error(errs[0]), err, pat)
+	}
+}
@@ -0,0 +1,272 @@
+package tre
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// exporter writes a tree in the syntax of another regular expression dialect.
+type exporter struct {
+	b         strings.Builder
+	ere       bool  // POSIX ERE syntax, otherwise RE2
+	groups    []int // group of the result for each capture group, ERE only
+	numGroups int   // groups written so far, ERE only
+}
+
+// RE2 returns p in the syntax of Go's regexp package, which matches the same
+// strings with the same capture groups. Named groups are written as
+// (?P<name> re ). It returns an *ExportError if a group name has characters
+// other than ASCII letters, digits and "_", or if a counted repetition is
+// larger than RE2 allows.
+func (p *Parsed) RE2() (string, error) {
+	e := &exporter{}
+	if err := e.write(p); err != nil {
+		return "", err
+	}
+	return e.b.String(), nil
+}
+
+// ERE returns p in POSIX extended regular expression syntax, which matches
+// the same strings, and the group number in the result of each capture group
+// of p. Parentheses that only group in p also capture in ERE, so the group
+// numbers can differ. It returns an *ExportError if p has lazy repetitions,
+// NUL characters, empty classes or counted repetitions larger than RE_DUP_MAX.
+func (p *Parsed) ERE() (string, []int, error) {
+	e := &exporter{ere: true, groups: make([]int, len(p.groupNames()))}
+	if err := e.write(p); err != nil {
+		return "", nil, err
+	}
+	return e.b.String(), e.groups, nil
+}
+
+// ExportError reports a part of an expression that can't be written in
+// another dialect.
+type ExportError struct {
+	Dialect string // "RE2" or "ERE"
+	Feature string // what is not supported
+	Expr    string // the subexpression using it, in tre syntax
+}
+
+func (e *ExportError) Error() string {
+	return fmt.Sprintf("%s: unsupported %s in %q", e.Dialect, e.Feature, e.Expr)
+}
+
+// unsupported returns an *ExportError for feature used by p.
+func (e *exporter) unsupported(p *Parsed, feature string) error {
+	dialect := "RE2"
+	if e.ere {
+		dialect = "ERE"
+	}
+	return &ExportError{Dialect: dialect, Feature: feature, Expr: p.String()}
+}
+
+// writeGroup writes p, grouping it in parentheses if paren is set.
+func (e *exporter) writeGroup(p *Parsed, paren bool) error {
+	if paren {
+		if e.ere {
+			e.numGroups++
+			e.b.WriteString("(")
+		} else {
+			e.b.WriteString("(?:")
+		}
+	}
+	if err := e.write(p); err != nil {
+		return err
+	}
+	if paren {
+		e.b.WriteString(")")
+	}
+	return nil
+}
+
+func (e *exporter) write(p *Parsed) error {
+	switch p.typ {
+	case ParseClass:
+		return e.writeClass(p)
+	case ParseBegin:
+		e.b.WriteString("^")
+	case ParseEnd:
+		e.b.WriteString("$")
+	case ParseConcat:
+		if err := e.writeGroup(p.left, p.left.typ == ParseAlt); err != nil {
+			return err
+		}
+		return e.writeGroup(p.right, p.right.typ == ParseAlt)
+	case ParseAlt:
+		if err := e.write(p.left); err != nil {
+			return err
+		}
+		e.b.WriteString("|")
+		return e.write(p.right)
+	case ParseCap:
+		e.b.WriteString("(")
+		if e.ere {
+			e.numGroups++
+			e.groups[p.capNum] = e.numGroups
+		} else if p.name != "" {
+			// Go only allows ASCII letters, digits and "_" in group names.
+			for _, ch := range p.name {
+				if ch >= utf8.RuneSelf || !isGroupNameRune(ch, false) {
+					return e.unsupported(p, "group name")
+				}
+			}
+			fmt.Fprintf(&e.b, "?P<%s>", p.name)
+		}
+		if err := e.write(p.left); err != nil {
+			return err
+		}
+		e.b.WriteString(")")
+	case ParseStar, ParsePlus, ParseOpt, ParseRepeat:
+		if p.lazy && e.ere {
+			return e.unsupported(p, "lazy repetition")
+		}
+		// neither dialect allows a repetition to be repeated directly.
+		paren := p.left.typ == ParseConcat || p.left.typ == ParseAlt || p.left.isRepetition()
+		if err := e.writeGroup(p.left, paren); err != nil {
+			return err
+		}
+		switch p.typ {
+		case ParseStar:
+			e.b.WriteString("*")
+		case ParsePlus:
+			e.b.WriteString("+")
+		case ParseOpt:
+			e.b.WriteString("?")
+		case ParseRepeat:
+			maxRepeat := 1000
+			if e.ere {
+				maxRepeat = 255 // _POSIX_RE_DUP_MAX
+			}
+			if max(p.min, p.max) > maxRepeat {
+				return e.unsupported(p, fmt.Sprintf("repeat count larger than %d", maxRepeat))
+			}
+			switch {
+			case p.max < 0:
+				fmt.Fprintf(&e.b, "{%d,}", p.min)
+			case p.max == p.min:
+				fmt.Fprintf(&e.b, "{%d}", p.min)
+			default:
+				fmt.Fprintf(&e.b, "{%d,%d}", p.min, p.max)
+			}
+		}
+		if p.lazy {
+			e.b.WriteString("?")
+		}
+	default:
+		panic(fmt.Errorf("unexpected %v", p.typ))
+	}
+	return nil
+}
+
+// writeRune writes ch to e, escaping it if it is in special.
+func (e *exporter) writeRune(ch rune, special string) {
+	switch {
+	case strings.ContainsRune(special, ch):
+		e.b.WriteRune('\\')
+		e.b.WriteRune(ch)
+	case !e.ere && !unicode.IsGraphic(ch):
+		fmt.Fprintf(&e.b, "\\x{%x}", ch)
+	default:
+		e.b.WriteRune(ch)
+	}
+}
+
+// writeClass writes the class node p to e.
+func (e *exporter) writeClass(p *Parsed) error {
+	// outside of classes both dialects escape with a backslash,
+	// but escaping a character that is not special is undefined in ERE.
+	special := "\\.+*?()|[]{}^$"
+	if e.ere {
+		special = "\\.+*?()|[{^$"
+	}
+	rs := p.class
+	switch {
+	case len(rs) == 1 && rs[0].rmin == rs[0].rmax:
+		if e.ere && rs[0].rmin == 0 {
+			return e.unsupported(p, "NUL character")
+		}
+		e.writeRune(rs[0].rmin, special)
+		return nil
+	case slices.Equal(rs, FullRanges()):
+		if e.ere {
+			e.b.WriteString(".")
+		} else {
+			e.b.WriteString("(?s:.)")
+		}
+		return nil
+	case len(rs) == 0:
+		if e.ere {
+			return e.unsupported(p, "empty class")
+		}
+		e.b.WriteString("[^\\x00-\\x{10ffff}]")
+		return nil
+	}
+
+	// classes that include characters past unicode.MaxRune were inverted.
+	inverted := rs.Contains(maxRune)
+	if inverted {
+		rs = rs.Invert()
+	}
+	if e.ere && rs.Contains(0) {
+		return e.unsupported(p, "NUL character")
+	}
+	e.b.WriteString("[")
+	if inverted {
+		e.b.WriteString("^")
+	}
+	start := e.b.Len()
+	if !e.ere {
+		for _, r := range rs {
+			e.writeRune(r.rmin, "\\[]-^")
+			if r.rmax > r.rmin {
+				e.b.WriteString("-")
+				e.writeRune(r.rmax, "\\[]-^")
+			}
+		}
+		e.b.WriteString("]")
+		return nil
+	}
+
+	// A backslash is literal in POSIX classes, but not in Go's,
+	// so it is written twice, which both read as one backslash.
+	// The other characters that can be special in a class are written
+	// where they are literal: "]" first, "[" where it can't start a
+	// class name, and "-" last.
+	var odd Ranges
+	for _, ch := range "\\]-[^" {
+		odd.Add1(ch)
+	}
+	_, found, rest := Diff(odd, rs)
+	if found.Contains(']') {
+		e.b.WriteString("]")
+	}
+	for _, r := range rest {
+		e.writeRune(r.rmin, "")
+		if r.rmax > r.rmin {
+			e.b.WriteString("-")
+			e.writeRune(r.rmax, "")
+		}
+	}
+	if found.Contains('\\') {
+		e.b.WriteString("\\\\")
+	}
+	if found.Contains('[') {
+		e.b.WriteString("[")
+	}
+	if found.Contains('^') {
+		if e.b.Len() == start && !inverted {
+			// the class is "^" and "-". "^" can't be first, so "-" is.
+			e.b.WriteString("-^]")
+			return nil
+		}
+		e.b.WriteString("^")
+	}
+	if found.Contains('-') {
+		e.b.WriteString("-")
+	}
+	e.b.WriteString("]")
+	return nil
+}
@@ -0,0 +1,182 @@
+package tre
+
+import (
+	"errors"
+	"math/rand"
+	"regexp"
+	"testing"
+
+	"github.com/alecthomas/assert"
+)
+
+func TestRE2(t *testing.T) {
+	tests := []struct {
+		pat  string
+		want string
+	}{
+		{"abc", "abc"},
+		{"(?a)(b|c)(?<x>d)", "(a)(?:b|c)(?P<x>d)"},
+		{"(ab)*?c+d?e{2,3}", "(?:ab)*?c+d?e{2,3}"},
+		{"(a*)?", "(?:a*)?"},
+		{"(a+?)*", "(?:a+?)*"},
+		{".", "(?s:.)"},
+		{"[^a]", "[^a]"},
+		{"[\\-\\]\\\\^a]", "[\\-\\\\-\\^a]"},
+		{"\\.\\*\\x2b\\?\\{\\x7c\\x24\\x5e", "\\.\\*\\+\\?\\{\\|\\$\\^"},
+		{"\\t\\u{2028}é", "\\x{9}\\x{2028}é"},
+		{"^a$", "^a$"},
+	}
+
+	for _, test := range tests {
+		p, err := Parse(test.pat)
+		assert.NoError(t, err, test.pat)
+		s, err := p.RE2()
+		assert.NoError(t, err, test.pat)
+		assert.Equal(t, s, test.want, test.pat)
+		regexp.MustCompile(s)
+	}
+}
+
+func TestERE(t *testing.T) {
+	tests := []struct {
+		pat    string
+		want   string
+		groups []int
+	}{
+		{"abc", "abc", []int{0}},
+		{"(?a)(b|c)(?<x>d)", "(a)(b|c)(d)", []int{0, 1, 3}},
+		{"((?a)b)*(?c)", "((a)b)*(c)", []int{0, 2, 3}},
+		{"(a*)?", "(a*)?", []int{0}},
+		{".[^a]", ".[^a]", []int{0}},
+		{"[\\-\\]\\\\a]", "[]a\\\\-]", []int{0}},
+		{"[\\x5e\\-]", "[-^]", []int{0}},
+		{"[^\\x5e]", "[^^]", []int{0}},
+		{"[\\x5ea\\[]", "[a[^]", []int{0}},
+		{"\\.\\*\\x2b\\?\\{}\\x7c\\x24\\x5e\\]", "\\.\\*\\+\\?\\{}\\|\\$\\^]", []int{0}},
+		{"^a{2,}$", "^a{2,}$", []int{0}},
+	}
+
+	for _, test := range tests {
+		p, err := Parse(test.pat)
+		assert.NoError(t, err, test.pat)
+		s, groups, err := p.ERE()
+		assert.NoError(t, err, test.pat)
+		assert.Equal(t, s, test.want, test.pat)
+		assert.Equal(t, groups, test.groups, test.pat)
+		regexp.MustCompilePOSIX(s)
+	}
+}
+
+func TestExportErrors(t *testing.T) {
+	p, err := Parse("a{1001}")
+	assert.NoError(t, err)
+	_, err = p.RE2()
+	assert.EqualError(t, err, "RE2: unsupported repeat count larger than 1000 in \"a{1001}\"")
+
+	tests := []struct {
+		pat     string
+		feature string
+		expr    string
+	}{
+		{"a*?", "lazy repetition", "a*?"},
+		{"a\\0", "NUL character", "\\0"},
+		{"[\\0a]", "NUL character", "[\\0a]"},
+		{"a{256}", "repeat count larger than 255", "a{256}"},
+	}
+	for _, test := range tests {
+		p, err := Parse(test.pat)
+		assert.NoError(t, err)
+		_, _, err = p.ERE()
+		var eerr *ExportError
+		assert.True(t, errors.As(err, &eerr), "%q %v", test.pat, err)
+		assert.Equal(t, eerr.Dialect, "ERE", test.pat)
+		assert.Equal(t, eerr.Feature, test.feature, test.pat)
+		assert.Equal(t, eerr.Expr, test.expr, test.pat)
+	}
+
+	// Go only accepts ASCII group names.
+	for _, pat := range []string{"(?<é>a)", "(?<x٣>a)"} {
+		p, err := Parse(pat)
+		assert.NoError(t, err)
+		_, err = p.RE2()
+		var eerr *ExportError
+		assert.True(t, errors.As(err, &eerr), "%q %v", pat, err)
+		assert.Equal(t, eerr.Feature, "group name", pat)
+	}
+	p, err = Parse("(?<_x1>a)")
+	assert.NoError(t, err)
+	s, err := p.RE2()
+	assert.NoError(t, err)
+	assert.Equal(t, regexp.MustCompile(s).SubexpNames(), []string{"", "_x1"})
+
+	_, _, err = CharClass(nil).ERE()
+	assert.EqualError(t, err, "ERE: unsupported empty class in \"[]\"")
+	s, err = CharClass(nil).RE2()
+	assert.NoError(t, err)
+	assert.False(t, regexp.MustCompile(s).MatchString("\x00a\U0010ffff"))
+}
+
+func TestRE2Submatch(t *testing.T) {
+	pats := []string{
+		"he(?ll)o(?a*)",
+		"(?a|ab)(?c|bcd)(?d*)",
+		"(?a*?)(?a*)",
+		"(?<x>(?a)|b)+c",
+		"^(?a{1,2})(?b$|c)*",
+		"[^b]*(?[a-c]+)d?",
+	}
+
+	for _, pat := range pats {
+		p, err := Parse(pat)
+		assert.NoError(t, err)
+		s, err := p.RE2()
+		assert.NoError(t, err)
+		re := regexp.MustCompile(s)
+		p2, err := ParseRE2(s)
+		assert.NoError(t, err)
+		nfa, nfa2 := MakeNfa(p), MakeNfa(p2)
+		assert.Equal(t, re.SubexpNames(), nfa.SubexpNames(), s)
+		for _, in := range allStrings("abcd", 5) {
+			assert.Equal(t, re.FindStringSubmatchIndex(in), nfa.FindSubmatchIndex(in), "%q %q %q", pat, s, in)
+			assert.Equal(t, nfa2.FindSubmatchIndex(in), nfa.FindSubmatchIndex(in), "%q %q %q", pat, s, in)
+		}
+	}
+}
+
+func TestExportRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	strs := allStrings("a]^-\\.", 3)
+	for range 20000 {
+		pat := randomString(r, "a()?|[]^{}*+-\\.,1$", 1+r.Intn(10))
+		p, err := Parse(pat)
+		if err != nil {
+			continue
+		}
+		nfa := MakeNfa(p)
+
+		s, err := p.RE2()
+		assert.NoError(t, err, pat)
+		re := regexp.MustCompile(s)
+		re.Longest()
+
+		ere, _, eerr := p.ERE()
+		var posix *regexp.Regexp
+		if eerr == nil {
+			posix = regexp.MustCompilePOSIX(ere)
+		} else {
+			// "[]" is an empty class.
+			var xerr *ExportError
+			assert.True(t, errors.As(eerr, &xerr), "%q %v", pat, eerr)
+			unsupported := xerr.Feature == "lazy repetition" || xerr.Feature == "empty class"
+			assert.True(t, unsupported, "%q %v", pat, eerr)
+		}
+
+		for _, in := range strs {
+			want := nfa.FindIndex(in)
+			assert.Equal(t, re.FindStringIndex(in), want, "%q %q %q", pat, s, in)
+			if posix != nil {
+				assert.Equal(t, posix.FindStringIndex(in), want, "%q %q %q", pat, ere, in)
+			}
+		}
+	}
+}
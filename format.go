@@ -0,0 +1,169 @@
+package tre
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// String returns p in canonical tre syntax with minimal parentheses.
+// Parsing the result yields a tree that matches the same strings
+// with the same captures.
+func (p *Parsed) String() string {
+	var b strings.Builder
+	p.format(&b)
+	return b.String()
+}
+
+// atomChars are the characters that must be escaped outside of classes.
+const atomChars = reservedChars + ".^$?"
+
+// writeRune writes ch to b, escaping it if it is in special or not graphic.
+func writeRune(b *strings.Builder, ch rune, special string) {
+	switch ch {
+	case '\n':
+		b.WriteString("\\n")
+	case '\r':
+		b.WriteString("\\r")
+	case '\t':
+		b.WriteString("\\t")
+	case '\f':
+		b.WriteString("\\f")
+	case '\v':
+		b.WriteString("\\v")
+	case 0:
+		b.WriteString("\\0")
+	default:
+		switch {
+		case strings.ContainsRune(special, ch) && unicode.IsPunct(ch):
+			b.WriteRune('\\')
+			b.WriteRune(ch)
+		case strings.ContainsRune(special, ch) || !unicode.IsGraphic(ch):
+			if ch <= 0xff {
+				fmt.Fprintf(b, "\\x%02x", ch)
+			} else {
+				fmt.Fprintf(b, "\\x{%x}", ch)
+			}
+		default:
+			b.WriteRune(ch)
+		}
+	}
+}
+
+// formatClass writes the class rs to b.
+func formatClass(b *strings.Builder, rs Ranges) {
+	if len(rs) == 1 && rs[0].rmin == rs[0].rmax {
+		writeRune(b, rs[0].rmin, atomChars)
+		return
+	}
+	if slices.Equal(rs, FullRanges()) {
+		b.WriteString(".")
+		return
+	}
+	for _, ch := range "dDwWsS" {
+		if class, _ := escapeClass(ch); slices.Equal(rs, class) {
+			b.WriteRune('\\')
+			b.WriteRune(ch)
+			return
+		}
+	}
+
+	// classes that include characters past unicode.MaxRune were inverted.
+	b.WriteString("[")
+	if rs.Contains(maxRune) {
+		b.WriteString("^")
+		rs = rs.Invert()
+	}
+	for idx, r := range rs {
+		special := reservedChars
+		if idx == 0 {
+			special += "^"
+		}
+		writeRune(b, r.rmin, special)
+		if r.rmax > r.rmin+1 {
+			b.WriteString("-")
+		}
+		if r.rmax > r.rmin {
+			writeRune(b, r.rmax, reservedChars)
+		}
+	}
+	b.WriteString("]")
+}
+
+// isRepetition returns true if p is a star, plus, optional or counted repetition.
+func (p *Parsed) isRepetition() bool {
+	switch p.typ {
+	case ParseStar, ParsePlus, ParseOpt, ParseRepeat:
+		return true
+	}
+	return false
+}
+
+// formatGroup writes p to b, in parentheses if paren is set.
+func (p *Parsed) formatGroup(b *strings.Builder, paren bool) {
+	if paren {
+		b.WriteString("(")
+	}
+	p.format(b)
+	if paren {
+		b.WriteString(")")
+	}
+}
+
+func (p *Parsed) format(b *strings.Builder) {
+	switch p.typ {
+	case ParseClass:
+		formatClass(b, p.class)
+	case ParseBegin:
+		b.WriteString("^")
+	case ParseEnd:
+		b.WriteString("$")
+	case ParseConcat:
+		p.left.formatGroup(b, p.left.typ == ParseAlt)
+		p.right.formatGroup(b, p.right.typ == ParseAlt)
+	case ParseAlt:
+		p.left.format(b)
+		b.WriteString("|")
+		p.right.format(b)
+	case ParseCap:
+		b.WriteString("(?")
+		if p.name != "" {
+			fmt.Fprintf(b, "<%s>", p.name)
+		}
+		// a body that starts like flags or a name is put in parentheses.
+		body := p.left.String()
+		if p.name == "" && body != "" && strings.ContainsRune("i-<", rune(body[0])) {
+			body = "(" + body + ")"
+		}
+		b.WriteString(body)
+		b.WriteString(")")
+	case ParseStar, ParsePlus, ParseOpt, ParseRepeat:
+		// a greedy repetition followed by "?" would be read as a lazy one.
+		paren := p.left.typ == ParseConcat || p.left.typ == ParseAlt ||
+			(p.typ == ParseOpt && p.left.isRepetition() && !p.left.lazy)
+		p.left.formatGroup(b, paren)
+		switch p.typ {
+		case ParseStar:
+			b.WriteString("*")
+		case ParsePlus:
+			b.WriteString("+")
+		case ParseOpt:
+			b.WriteString("?")
+		case ParseRepeat:
+			switch {
+			case p.max < 0:
+				fmt.Fprintf(b, "{%d,}", p.min)
+			case p.max == p.min:
+				fmt.Fprintf(b, "{%d}", p.min)
+			default:
+				fmt.Fprintf(b, "{%d,%d}", p.min, p.max)
+			}
+		}
+		if p.lazy {
+			b.WriteString("?")
+		}
+	default:
+		fmt.Fprintf(b, "<%v>", p.typ)
+	}
+}
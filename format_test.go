@@ -0,0 +1,115 @@
+package tre
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/alecthomas/assert"
+)
+
+func TestParsedString(t *testing.T) {
+	tests := []struct {
+		pat  string
+		want string
+	}{
+		{"abc", "abc"},
+		{"(ab)c", "abc"},
+		{"a(b|c)d", "a(b|c)d"},
+		{"(a|b)|c", "a|b|c"},
+		{"(ab)*", "(ab)*"},
+		{"(a|b)+?", "(a|b)+?"},
+		{"(a*)?", "(a*)?"},
+		{"a*??", "a*??"},
+		{"a{2}{3,}b{1,2}?", "a{2}{3,}b{1,2}?"},
+		{"[a-cx]", "[a-cx]"},
+		{"[ab]", "[ab]"},
+		{"[^a-z]", "[^a-z]"},
+		{".", "."},
+		{"[\\d]\\W\\s", "\\d\\W\\s"},
+		{"\\.\\*\\-\\?\\{\\}", "\\.\\*\\-\\?\\{}"},
+		{"\\x2b\\x7c\\x24\\x5e", "\\x2b\\x7c\\x24\\x5e"},
+		{"[\\x5ea]", "[\\x5ea]"},
+		{"[a^]", "[\\x5ea]"},
+		{"[!^]", "[!^]"},
+		{"[\\-\\]\\\\]", "[\\-\\\\\\]]"},
+		{"[\\{a]", "[a\\{]"},
+		{"\\t\\n\\0\\x01\\u{2028}é", "\\t\\n\\0\\x01\\x{2028}é"},
+		{"^a$", "^a$"},
+		{"(?a)(?<n>b)", "(?a)(?<n>b)"},
+		{"(?(<)a)", "(?(<a))"},
+		{"(?i)k", "[Kk\u212a]"},
+	}
+
+	for _, test := range tests {
+		p, err := Parse(test.pat)
+		assert.NoError(t, err, test.pat)
+		assert.Equal(t, p.String(), test.want, test.pat)
+
+		p2, err := Parse(p.String())
+		assert.NoError(t, err, test.want)
+		assert.Equal(t, p2.String(), test.want)
+	}
+}
+
+func TestParsedStringFlagLikeCapture(t *testing.T) {
+	// a capture of "i" or "-i" is not written like a flag group.
+	for _, test := range []struct {
+		p    *Parsed
+		want string
+	}{
+		{Cap(Literal("i"), ""), "(?(i))"},
+		{Cap(Literal("-i:a"), ""), "(?\\-i:a)"},
+	} {
+		assert.Equal(t, test.p.String(), test.want)
+		p, err := Parse(test.want)
+		assert.NoError(t, err, test.want)
+		assert.Equal(t, p.String(), test.want)
+		assert.Equal(t, len(p.groupNames()), 2, test.want)
+	}
+}
+
+func TestParsedStringRoundTrip(t *testing.T) {
+	pats := []string{
+		"he(?ll)o(?a*)",
+		"(?a|ab)(?c|bcd)(?d*)",
+		"(?a*?)(?a*)",
+		"(?(?a)|b)*",
+		"^(?a*)(?b$|c)*",
+		"(?a{1,2})(?a{1,2}?)",
+		"[^b]*(?[a-c]+)d?",
+		"((a|b)c)*|d+",
+		"(?<x>a)(?b)?",
+	}
+
+	for _, pat := range pats {
+		p, err := Parse(pat)
+		assert.NoError(t, err)
+		p2, err := Parse(p.String())
+		assert.NoError(t, err, p.String())
+		nfa, nfa2 := MakeNfa(p), MakeNfa(p2)
+		for _, s := range allStrings("abcd", 5) {
+			assert.Equal(t, nfa2.SubmatchIndex(s), nfa.SubmatchIndex(s), "%q %q %q", pat, p.String(), s)
+		}
+		assert.Equal(t, nfa2.SubexpNames(), nfa.SubexpNames())
+	}
+}
+
+func TestParsedStringRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for range 20000 {
+		pat := randomString(r, "ab()?|[]^{}*+-\\.,1$<i:", 1+r.Intn(10))
+		p, err := Parse(pat)
+		if err != nil {
+			continue
+		}
+		s := p.String()
+		p2, err := Parse(s)
+		assert.NoError(t, err, "%q %q", pat, s)
+		assert.Equal(t, p2.String(), s, pat)
+
+		nfa, nfa2 := MakeNfa(p), MakeNfa(p2)
+		for _, in := range allStrings("ab", 3) {
+			assert.Equal(t, nfa2.SubmatchIndex(in), nfa.SubmatchIndex(in), "%q %q %q", pat, s, in)
+		}
+	}
+}
@@ -0,0 +1,298 @@
+package tre
+
+import (
+	"strings"
+)
+
+// DefaultLazyStates is the state cache size used by NewLazyDfa.
+const DefaultLazyStates = 10000
+
+// minRunesPerState is how many runes must be matched for each cached state
+// between flushes of the cache. If fewer are matched, the cache is thrashing
+// and matching falls back to simulating the NFA.
+const minRunesPerState = 10
+
+type lazyEdge struct {
+	class Class
+	next  *lazyState // nil if no NFA states are reached
+}
+
+// lazyState is a DFA state that is built from its NFA states on demand.
+type lazyState struct {
+	set       []*nfaState
+	caps      []int
+	accept    bool // accepting at the end of input
+	acceptMid bool // accepting with more input remaining
+	classes   []Ranges
+	edges     []lazyEdge
+}
+
+// LazyDfa is a DFA whose states are built only as the input reaches them.
+// At most maxStates states are kept in a cache, which is flushed when it fills up.
+// Matching updates the cache, so a LazyDfa must not be used by more than one
+// goroutine at a time.
+type LazyDfa struct {
+	nfa       *Nfa
+	maxStates int
+	cache     map[string]*lazyState
+	start     *lazyState
+	midStart  *lazyState
+
+	flushes    int
+	sinceFlush int // runes matched since the last flush
+
+	groupNames
+}
+
+func MakeLazyDfa(n *Nfa, maxStates int) *LazyDfa {
+	return &LazyDfa{
+		nfa:       n,
+		maxStates: max(maxStates, 2),
+		cache:     make(map[string]*lazyState),
+
+		groupNames: n.groupNames,
+	}
+}
+
+func NewLazyDfa(re string) (*LazyDfa, error) {
+	nfa, err := NewNfa(re)
+	if err != nil {
+		return nil, err
+	}
+	return MakeLazyDfa(nfa, DefaultLazyStates), nil
+}
+
+// flush empties the state cache.
+func (d *LazyDfa) flush() {
+	d.cache = make(map[string]*lazyState)
+	d.start = nil
+	d.midStart = nil
+	d.flushes++
+	d.sinceFlush = 0
+}
+
+// state finds the cached state for set, or builds a new one,
+// flushing the cache first if it is full.
+// The assertions in at hold at the position where set is reached.
+// It returns false if the cache is full and thrashing.
+func (d *LazyDfa) state(set []*nfaState, caps []int, at anchors) (*lazyState, bool) {
+	sortNfas(set)
+	accept := acceptsAt(set, at|atEnd)
+	key := nfaSetKey(set, caps, accept)
+	if st, ok := d.cache[key]; ok {
+		return st, true
+	}
+
+	if len(d.cache) >= d.maxStates {
+		if d.sinceFlush < d.maxStates*minRunesPerState {
+			return nil, false
+		}
+		d.flush()
+	}
+	st := &lazyState{set: set, caps: caps, accept: accept, acceptMid: accepts(set)}
+	d.cache[key] = st
+	return st, true
+}
+
+// step returns the state reached from st on ch, building it if needed.
+// It returns false if the cache is thrashing and the caller should
+// fall back to simulating the NFA.
+func (d *LazyDfa) step(st *lazyState, ch rune) (*lazyState, bool) {
+	d.sinceFlush++
+	for _, edge := range st.edges {
+		if edge.class.Contains(ch) {
+			return edge.next, true
+		}
+	}
+
+	if st.classes == nil {
+		st.classes = disjointClasses(st.set)
+	}
+	var class Ranges
+	for _, c := range st.classes {
+		if c.Contains(ch) {
+			class = c
+			break
+		}
+	}
+	if class == nil {
+		// no NFA state accepts ch, or any other character outside of the classes.
+		var dead Ranges
+		for _, c := range st.classes {
+			dead.AddRanges(c)
+		}
+		st.edges = append(st.edges, lazyEdge{class: NewClass(dead.Invert())})
+		return nil, true
+	}
+
+	ns, caps := advance(st.set, ch)
+	var next *lazyState
+	if len(ns) > 0 {
+		flushes := d.flushes
+		var ok bool
+		next, ok = d.state(ns, caps, 0)
+		if !ok {
+			return nil, false
+		}
+		if d.flushes != flushes {
+			// keep the current state usable, but forget its edges into the old cache.
+			st.edges = nil
+		}
+	}
+	st.edges = append(st.edges, lazyEdge{class: NewClass(class), next: next})
+	return next, true
+}
+
+// lazyCursor tracks a match through a lazy DFA. If the DFA cache thrashes
+// it switches to simulating the NFA from the NFA states of the DFA state.
+type lazyCursor struct {
+	d    *LazyDfa
+	st   *lazyState  // nil after falling back
+	ns   []*nfaState // after falling back
+	caps []int
+}
+
+// startState returns the start state for matches starting at a position
+// where the assertions in at hold, which are the beginning of input or past it.
+// It returns false if the cache thrashed.
+func (d *LazyDfa) startState(at anchors) (*lazyState, bool) {
+	start := &d.midStart
+	if at&atBegin != 0 {
+		start = &d.start
+	}
+	if *start == nil {
+		st, ok := d.state(advanceEpsilon(d.nfa.start, at&atBegin), []int{}, at&atBegin)
+		if !ok {
+			return nil, false
+		}
+		*start = st
+	}
+	return *start, true
+}
+
+// cursor returns a cursor at the start state for matches
+// starting at the beginning of input, or past it.
+func (d *LazyDfa) cursor(begin bool) *lazyCursor {
+	at := anchors(0)
+	if begin {
+		at = atBegin
+	}
+
+	c := &lazyCursor{d: d}
+	st, ok := d.startState(at)
+	if !ok {
+		c.ns = advanceEpsilon(d.nfa.start, at)
+		return c
+	}
+	c.st = st
+	return c
+}
+
+func (c *lazyCursor) step(ch rune) bool {
+	if c.st != nil {
+		next, ok := c.d.step(c.st, ch)
+		if ok {
+			c.st = next
+			if next == nil {
+				return false
+			}
+			c.caps = next.caps
+			return true
+		}
+		c.ns = c.st.set
+		c.st = nil
+	}
+
+	c.ns, c.caps = advance(c.ns, ch)
+	return len(c.ns) > 0
+}
+
+// accepting returns true if the cursor accepts at a position where the assertions in at hold.
+func (c *lazyCursor) accepting(at anchors) bool {
+	if c.st != nil {
+		if at&atEnd != 0 {
+			return c.st.accept
+		}
+		return c.st.acceptMid
+	}
+	return acceptsAt(c.ns, at)
+}
+
+// lazySearch runs a lazy DFA in findLongest. It records when the cache
+// thrashes, and the search is then repeated on the NFA.
+type lazySearch struct {
+	d         *LazyDfa
+	thrashing bool
+}
+
+func (ls *lazySearch) start(at anchors, add func(*lazyState) bool) {
+	st, ok := ls.d.startState(at)
+	if !ok {
+		ls.thrashing = true
+		return
+	}
+	add(st)
+}
+
+func (ls *lazySearch) step(st *lazyState, ch rune, add func(*lazyState) bool) {
+	next, ok := ls.d.step(st, ch)
+	if !ok {
+		ls.thrashing = true
+		return
+	}
+	if next != nil {
+		add(next)
+	}
+}
+
+func (ls *lazySearch) accepting(st *lazyState, at anchors) bool {
+	if at&atEnd != 0 {
+		return st.accept
+	}
+	return st.acceptMid
+}
+
+// FindIndex returns the byte offsets of the leftmost longest match of d in s,
+// or nil if there is no match. The match need not cover all of s.
+func (d *LazyDfa) FindIndex(s string) []int {
+	ls := &lazySearch{d: d}
+	res := findLongest(ls, s)
+	if ls.thrashing {
+		return d.nfa.FindIndex(s)
+	}
+	return res
+}
+
+func (d *LazyDfa) Match(s string) ([]string, bool) {
+	capGroups := make(map[int]*strings.Builder)
+	maxGroup := 0
+	c := d.cursor(true)
+	for _, ch := range s {
+		if !c.step(ch) {
+			return nil, false
+		}
+
+		for _, capIdx := range c.caps {
+			if _, ok := capGroups[capIdx]; !ok {
+				if capIdx > maxGroup {
+					maxGroup = capIdx
+				}
+				capGroups[capIdx] = &strings.Builder{}
+			}
+			capGroups[capIdx].WriteRune(ch)
+		}
+	}
+
+	if !c.accepting(anchorsAt(s, len(s))) {
+		return nil, false
+	}
+
+	var groups []string
+	if maxGroup > 0 {
+		groups = make([]string, maxGroup)
+		for n, g := range capGroups {
+			groups[n-1] = g.String()
+		}
+	}
+	return groups, true
+}
@@ -0,0 +1,65 @@
+package tre
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/assert"
+)
+
+func randomString(r *rand.Rand, alphabet string, n int) string {
+	var b strings.Builder
+	for range n {
+		b.WriteByte(alphabet[r.Intn(len(alphabet))])
+	}
+	return b.String()
+}
+
+func TestLazyDfa(t *testing.T) {
+	// MakeDfa would build over a million states for this pattern.
+	nfa, err := NewNfa(".*a.{20}")
+	assert.NoError(t, err)
+
+	r := rand.New(rand.NewSource(1))
+	for _, maxStates := range []int{8, 1000, DefaultLazyStates} {
+		lazy := MakeLazyDfa(nfa, maxStates)
+		for range 50 {
+			s := randomString(r, "ab", 10+r.Intn(40))
+			_, want := nfa.Match(s)
+			_, got := lazy.Match(s)
+			assert.Equal(t, got, want, "%d %q", maxStates, s)
+			assert.Equal(t, lazy.FindIndex(s), nfa.FindIndex(s), "%d %q", maxStates, s)
+			assert.True(t, len(lazy.cache) <= maxStates)
+		}
+	}
+}
+
+func TestLazyDfaFlush(t *testing.T) {
+	nfa, err := NewNfa("a*b*c*d*")
+	assert.NoError(t, err)
+	lazy := MakeLazyDfa(nfa, 2)
+
+	// long runs in each state let the cache be flushed instead of falling back.
+	s := strings.Repeat("a", 100) + strings.Repeat("b", 100) + strings.Repeat("c", 100) + strings.Repeat("d", 100)
+	_, match := lazy.Match(s)
+	assert.True(t, match)
+	assert.True(t, lazy.flushes > 0)
+	assert.True(t, len(lazy.cache) <= 2)
+
+	_, match = lazy.Match(s + "a")
+	assert.False(t, match)
+}
+
+func TestLazyDfaDeadEdges(t *testing.T) {
+	lazy, err := NewLazyDfa("ab")
+	assert.NoError(t, err)
+
+	// characters that no NFA state accepts share a single dead edge.
+	var b strings.Builder
+	for ch := rune(0x4e00); ch < 0x4e00+1000; ch++ {
+		b.WriteRune(ch)
+	}
+	assert.Equal(t, lazy.FindIndex(b.String()+"ab"), []int{3000, 3002})
+	assert.Equal(t, len(lazy.midStart.edges), 2)
+}
@@ -0,0 +1,201 @@
+package tre
+
+import (
+	"fmt"
+)
+
+// Minimize merges equivalent states of d in place using Hopcroft's
+// partition refinement. States are only equivalent if they agree on
+// acceptance and caps. It returns the number of states before and after.
+// The remaining states are renumbered.
+// Tagged DFAs are left unchanged.
+func (d *Dfa) Minimize() (int, int) {
+	states := d.states()
+	if d.start.tags != nil {
+		return len(states), len(states)
+	}
+
+	// The alphabet is the set of disjoint classes of all edges.
+	var classes []Ranges
+	for _, s := range states {
+		for _, edge := range s.edges {
+			classes = append(classes, edge.class.ranges)
+		}
+	}
+	alphabet := disjointRanges(classes)
+
+	// delta[s][a] is the target of state s on symbol a.
+	// Missing edges go to an extra dead state.
+	dead := len(states)
+	ids := make(map[*dfaState]int)
+	for id, s := range states {
+		ids[s] = id
+	}
+	delta := make([][]int, len(states)+1)
+	for id := range delta {
+		delta[id] = make([]int, len(alphabet))
+		for a, class := range alphabet {
+			delta[id][a] = dead
+			if id != dead {
+				if next := matchChar(states[id], class[0].rmin); next != nil {
+					delta[id][a] = ids[next]
+				}
+			}
+		}
+	}
+
+	// inverse[a][t] lists the states that go to t on symbol a.
+	inverse := make([][][]int, len(alphabet))
+	for a := range alphabet {
+		inverse[a] = make([][]int, len(delta))
+		for s := range delta {
+			t := delta[s][a]
+			inverse[a][t] = append(inverse[a][t], s)
+		}
+	}
+
+	// The initial partition groups states that agree on acceptance and caps.
+	var blocks [][]int
+	blockOf := make([]int, len(delta))
+	keys := make(map[string]int)
+	for s := range delta {
+		key := "dead"
+		if s != dead {
+			key = fmt.Sprintf("%v %v %v", states[s].accept, states[s].acceptMid, states[s].caps)
+		}
+		if key == "false false []" {
+			// non-accepting states without caps might be dead.
+			key = "dead"
+		}
+		b, ok := keys[key]
+		if !ok {
+			b = len(blocks)
+			keys[key] = b
+			blocks = append(blocks, nil)
+		}
+		blocks[b] = append(blocks[b], s)
+		blockOf[s] = b
+	}
+
+	// Hopcroft's algorithm: every block except the largest is a splitter at first,
+	// and after a split only the smaller half needs to be added.
+	inWork := make([]bool, len(blocks))
+	largest := 0
+	for b := range blocks {
+		if len(blocks[b]) > len(blocks[largest]) {
+			largest = b
+		}
+	}
+	var work []int
+	for b := range blocks {
+		if b != largest {
+			work = append(work, b)
+			inWork[b] = true
+		}
+	}
+
+	marked := make([]bool, len(delta))
+	for len(work) > 0 {
+		splitter := blocks[work[0]]
+		inWork[work[0]] = false
+		work = work[1:]
+
+		for a := range alphabet {
+			// mark the states that lead into the splitter on a.
+			var touched []int
+			for _, t := range splitter {
+				for _, s := range inverse[a][t] {
+					if !marked[s] {
+						marked[s] = true
+						touched = append(touched, blockOf[s])
+					}
+				}
+			}
+
+			// split every block that has both marked and unmarked states.
+			for _, b := range touched {
+				var in, out []int
+				for _, s := range blocks[b] {
+					if marked[s] {
+						in = append(in, s)
+					} else {
+						out = append(out, s)
+					}
+				}
+				if len(in) == 0 || len(out) == 0 {
+					continue
+				}
+
+				nb := len(blocks)
+				blocks[b] = in
+				blocks = append(blocks, out)
+				inWork = append(inWork, false)
+				for _, s := range out {
+					blockOf[s] = nb
+				}
+				switch {
+				case inWork[b]:
+					work = append(work, nb)
+					inWork[nb] = true
+				case len(in) <= len(out):
+					work = append(work, b)
+					inWork[b] = true
+				default:
+					work = append(work, nb)
+					inWork[nb] = true
+				}
+			}
+
+			for _, t := range splitter {
+				for _, s := range inverse[a][t] {
+					marked[s] = false
+				}
+			}
+		}
+	}
+
+	// Each block is replaced by one representative state,
+	// keeping the start states so that d stays valid.
+	reps := make([]*dfaState, len(blocks))
+	for _, s := range []*dfaState{d.start, d.midStart} {
+		if reps[blockOf[ids[s]]] == nil {
+			reps[blockOf[ids[s]]] = s
+		}
+	}
+	for b, members := range blocks {
+		if reps[b] == nil && b != blockOf[dead] {
+			reps[b] = states[members[0]]
+		}
+	}
+
+	edges := make(map[*dfaState][]Edge)
+	for _, rep := range reps {
+		if rep == nil {
+			continue
+		}
+		var newEdges []Edge
+	next:
+		for _, edge := range rep.edges {
+			tb := blockOf[ids[edge.next]]
+			if tb == blockOf[dead] {
+				continue
+			}
+			targ := reps[tb]
+			for n := range newEdges {
+				if newEdges[n].next == targ {
+					newEdges[n].class = newEdges[n].class.Union(edge.class.ranges)
+					continue next
+				}
+			}
+			newEdges = append(newEdges, Edge{class: edge.class, next: targ})
+		}
+		edges[rep] = newEdges
+	}
+	for rep, newEdges := range edges {
+		rep.edges = newEdges
+	}
+	d.midStart = reps[blockOf[ids[d.midStart]]]
+
+	numberDfa(d)
+	return len(states), len(d.states())
+}
@@ -0,0 +1,51 @@
+package tre
+
+import (
+	"testing"
+
+	"github.com/alecthomas/assert"
+)
+
+func TestMinimize(t *testing.T) {
+	tests := []struct {
+		pat    string
+		before int
+		after  int
+	}{
+		{"(a|b)*abb", 4, 4},
+		{"ab|xb", 4, 3},
+		{"[a-b]{3}y|[x-y]{3}y", 8, 7},
+		{"hello|help|hellp|helo", 6, 6},
+		{"a*", 1, 1},
+		{"x(a|b)*y", 3, 3},
+		{"a^b", 1, 1},
+	}
+
+	for _, test := range tests {
+		dfa, err := NewDfa(test.pat)
+		assert.NoError(t, err)
+		orig, err := NewDfa(test.pat)
+		assert.NoError(t, err)
+
+		before, after := dfa.Minimize()
+		assert.Equal(t, before, test.before, test.pat)
+		assert.Equal(t, after, test.after, test.pat)
+		assert.Equal(t, len(dfa.states()), after, test.pat)
+
+		for _, s := range allStrings("abelhpxy", 4) {
+			_, want := orig.Match(s)
+			_, got := dfa.Match(s)
+			assert.Equal(t, got, want, "%q %q", test.pat, s)
+			assert.Equal(t, dfa.FindIndex(s), orig.FindIndex(s), "%q %q", test.pat, s)
+		}
+	}
+}
+
+func TestMinimizeKeepsCaps(t *testing.T) {
+	dfa, err := NewDfa("(?a)b|ab")
+	assert.NoError(t, err)
+	dfa.Minimize()
+	groups, match := dfa.Match("ab")
+	assert.True(t, match)
+	assert.Equal(t, groups, []string{"a"})
+}
@@ -0,0 +1,75 @@
+package tre
+
+// groupNames holds the names of the capture groups of a machine by group
+// number. Group 0 is the whole match and unnamed groups have empty names.
+type groupNames []string
+
+// groupNames returns the names of the capture groups in p.
+func (p *Parsed) groupNames() groupNames {
+	names := groupNames{""}
+	var walk func(p *Parsed)
+	walk = func(p *Parsed) {
+		if p == nil {
+			return
+		}
+		if p.typ == ParseCap {
+			for len(names) <= p.capNum {
+				names = append(names, "")
+			}
+			names[p.capNum] = p.name
+		}
+		walk(p.left)
+		walk(p.right)
+	}
+	walk(p)
+	return names
+}
+
+// SubexpNames returns the names of the capture groups by group number,
+// like regexp.SubexpNames.
+func (g groupNames) SubexpNames() []string {
+	if g == nil {
+		return []string{""}
+	}
+	return g
+}
+
+// SubexpIndex returns the number of the capture group with the given name,
+// or -1 if there is no such group.
+func (g groupNames) SubexpIndex(name string) int {
+	if name == "" {
+		return -1
+	}
+	for idx, n := range g {
+		if n == name {
+			return idx
+		}
+	}
+	return -1
+}
+
+type NamedMatcher interface {
+	Matcher
+	SubexpNames() []string
+}
+
+// MatchNamed matches m against s like Match and returns the named capture
+// groups by name. Named groups that did not capture anything are empty.
+func MatchNamed(m NamedMatcher, s string) (map[string]string, bool) {
+	groups, ok := m.Match(s)
+	if !ok {
+		return nil, false
+	}
+
+	named := make(map[string]string)
+	for idx, name := range m.SubexpNames() {
+		if name == "" {
+			continue
+		}
+		named[name] = ""
+		if idx-1 < len(groups) {
+			named[name] = groups[idx-1]
+		}
+	}
+	return named, true
+}
@@ -0,0 +1,57 @@
+package tre
+
+import (
+	"testing"
+
+	"github.com/alecthomas/assert"
+)
+
+func TestSubexpNames(t *testing.T) {
+	nfa, err := NewNfa("(?<year>\\d{4})\\-(?\\d{2})\\-(?<day>\\d{2})")
+	assert.NoError(t, err)
+	dfa := MakeDfa(nfa)
+
+	machines := []NamedMatcher{nfa, dfa, MakeLazyDfa(nfa, 10), dfa.Compile(), MakeTaggedDfa(nfa)}
+	for _, m := range machines {
+		assert.Equal(t, m.SubexpNames(), []string{"", "year", "", "day"})
+	}
+	assert.Equal(t, nfa.SubexpIndex("year"), 1)
+	assert.Equal(t, nfa.SubexpIndex("day"), 3)
+	assert.Equal(t, nfa.SubexpIndex("month"), -1)
+	assert.Equal(t, nfa.SubexpIndex(""), -1)
+
+	match := nfa.SubmatchIndex("2024-06-01")
+	day := nfa.SubexpIndex("day")
+	assert.Equal(t, match[2*day:2*day+2], []int{8, 10})
+
+	nfa, err = NewNfa("abc")
+	assert.NoError(t, err)
+	assert.Equal(t, nfa.SubexpNames(), []string{""})
+}
+
+func TestMatchNamed(t *testing.T) {
+	dfa, err := NewDfa("(?<key>\\w+)=(?<value>\\w*)(?<comment>#\\w*)?")
+	assert.NoError(t, err)
+
+	named, ok := MatchNamed(dfa, "user=tim")
+	assert.True(t, ok)
+	assert.Equal(t, named, map[string]string{"key": "user", "value": "tim", "comment": ""})
+
+	named, ok = MatchNamed(dfa.Compile(), "x=#note")
+	assert.True(t, ok)
+	assert.Equal(t, named, map[string]string{"key": "x", "value": "", "comment": "#note"})
+
+	_, ok = MatchNamed(dfa, "=tim")
+	assert.False(t, ok)
+}
+
+func TestGroupNameErrors(t *testing.T) {
+	for _, pat := range []string{"(?<>a)", "(?<1a>a)", "(?<a b>a)", "(?<a", "(?<a>a)(?<a>b)"} {
+		_, err := Parse(pat)
+		assert.Error(t, err, pat)
+	}
+
+	p, err := Parse("(?<a_1>x)(?<é>y)")
+	assert.NoError(t, err)
+	assert.Equal(t, []string(p.groupNames()), []string{"", "a_1", "é"})
+}
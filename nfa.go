@@ -2,21 +2,43 @@ package tre
 
 import (
 	"fmt"
+	"io"
 	"os"
+	"slices"
 	"strings"
 )
 
-type Nfa struct {
-	class  Ranges // unless split is true
-	caps   []int  // unless split is true
-	next1  *Nfa
-	next2  *Nfa // if split is true
+// nfaState is a state in an NFA. States that consume characters have a class.
+// Split states are epsilon transitions to next1 or next2, with next1 being preferred.
+// Begin, end and save states are epsilon transitions to next1.
+type nfaState struct {
+	id     int   // unique within the NFA, assigned by MakeNfa
+	class  Class // unless split, begin, end or save is true
+	caps   []int // unless split, begin, end or save is true
+	lazy   []int // lazy repetitions enclosing the state, unless split, begin, end or save is true
+	next1  *nfaState
+	next2  *nfaState // if split is true
 	split  bool
+	begin  bool // zero-width, matches only at the start of input
+	end    bool // zero-width, matches only at the end of input
+	save   bool // records the input position in slot
+	slot   int  // if save is true
 	accept bool
 }
 
+// Nfa is an NFA built by MakeNfa from its start state.
+type Nfa struct {
+	start *nfaState
+	groupNames
+}
+
+func (p *nfaState) String() string {
+	return fmt.Sprintf("[class=%v caps=%v split=%v begin=%v end=%v save=%v slot=%v accept=%v]", p.class, p.caps, p.split, p.begin, p.end, p.save, p.slot, p.accept)
+}
+
+// String describes the start state of p.
 func (p *Nfa) String() string {
-	return fmt.Sprintf("[class=%v caps=%v split=%v accept=%v]", p.class, p.caps, p.split, p.accept)
+	return p.start.String()
 }
 
 func (p *Nfa) Dot(fn, label string) {
@@ -32,33 +54,33 @@ func (p *Nfa) Dot(fn, label string) {
 		}
 		defer fp.Close()
 	}
+	p.WriteDot(fp, label)
+}
 
-	nextId := 0
-	ids := make(map[*Nfa]int)
-	ids[nil] = 999999 // in case something goes wrong
-	getId := func(p *Nfa) (int, bool) {
-		id, ok := ids[p]
-		if ok {
-			return id, ok
-		}
-		nextId++
-		ids[p] = nextId
-		return nextId, false
-	}
-
-	walk := func(p *Nfa) {}
-	walk = func(p *Nfa) {
-		id, ok := getId(p)
-		if ok {
+// WriteDot writes the NFA p to w in graphviz format.
+// States are labelled with the ids assigned by MakeNfa.
+func (p *Nfa) WriteDot(w io.Writer, label string) {
+	visited := make(map[*nfaState]struct{})
+	walk := func(p *nfaState) {}
+	walk = func(p *nfaState) {
+		if _, ok := visited[p]; ok {
 			return
 		}
+		visited[p] = struct{}{}
 
+		id := p.id
 		if p.accept {
-			fmt.Fprintf(fp, "  node_%d [label = \"accept\"]\n", id)
+			fmt.Fprintf(w, "  node_%d [label = \"accept\"]\n", id)
+		} else if p.begin {
+			fmt.Fprintf(w, "  node_%d [label = \"%d\\n^\"]\n", id, id)
+		} else if p.end {
+			fmt.Fprintf(w, "  node_%d [label = \"%d\\n$\"]\n", id, id)
+		} else if p.save {
+			fmt.Fprintf(w, "  node_%d [label = \"%d\\nsave=%d\"]\n", id, id, p.slot)
 		} else if len(p.caps) > 0 {
-			fmt.Fprintf(fp, "  node_%d [label = \"%d\\ncaps=%v\"]\n", id, id, p.caps)
+			fmt.Fprintf(w, "  node_%d [label = \"%d\\ncaps=%v\"]\n", id, id, p.caps)
 		} else {
-			fmt.Fprintf(fp, "  node_%d [label = \"%d\"]\n", id, id)
+			fmt.Fprintf(w, "  node_%d [label = \"%d\"]\n", id, id)
 		}
 
 		if p.next1 != nil {
@@ -68,87 +90,205 @@ func (p *Nfa) Dot(fn, label string) {
 			walk(p.next2)
 		}
 		if p.split {
-			fmt.Fprintf(fp, "  node_%d -> node_%d\n", id, ids[p.next1])
-			fmt.Fprintf(fp, "  node_%d -> node_%d\n", id, ids[p.next2])
+			fmt.Fprintf(w, "  node_%d -> node_%d\n", id, p.next1.id)
+			fmt.Fprintf(w, "  node_%d -> node_%d\n", id, p.next2.id)
+		} else if p.begin || p.end || p.save {
+			fmt.Fprintf(w, "  node_%d -> node_%d\n", id, p.next1.id)
 		} else if !p.accept {
-			fmt.Fprintf(fp, "  node_%d -> node_%d [label = \"%v\"]\n", id, ids[p.next1], p.class)
+			fmt.Fprintf(w, "  node_%d -> node_%d [label = \"%v\"]\n", id, p.next1.id, p.class)
 		}
 	}
 
-	fmt.Fprintf(fp, "digraph G {\n")
-	fmt.Fprintf(fp, "  graph [rankdir = LR, label=%q]\n", label)
-	walk(p)
-	fmt.Fprintf(fp, "}\n")
+	fmt.Fprintf(w, "digraph G {\n")
+	fmt.Fprintf(w, "  graph [rankdir = LR, label=%q]\n", label)
+	walk(p.start)
+	fmt.Fprintf(w, "}\n")
 }
 
 type Frag struct {
-	start *Nfa
-	ends  []**Nfa
+	start *nfaState
+	ends  []**nfaState
 }
 
-func frag(start *Nfa, ends ...**Nfa) *Frag {
+func frag(start *nfaState, ends ...**nfaState) *Frag {
 	return &Frag{start: start, ends: ends}
 }
 
-func (p *Frag) outTo(start *Nfa) {
+func (p *Frag) outTo(start *nfaState) {
 	for _, pEnd := range p.ends {
 		*pEnd = start
 	}
 }
 
-func nfaFrag(p *Parsed) *Frag {
+// splitTo returns a split state that prefers going to body, or skipping it
+// if lazy is set, and a pointer to its edge that skips body.
+func splitTo(body *nfaState, lazy bool) (*nfaState, **nfaState) {
+	if lazy {
+		alt := &nfaState{split: true, next2: body}
+		return alt, &alt.next1
+	}
+	alt := &nfaState{split: true, next1: body}
+	return alt, &alt.next2
+}
+
+// nfaBuilder builds NFA fragments, tracking the lazy repetitions
+// that enclose the states being built.
+type nfaBuilder struct {
+	lazy    []int // numbers of the enclosing lazy repetitions, outermost first
+	numLazy int   // lazy repetitions numbered so far
+}
+
+// newLazy returns a new number for the repetition p if it is lazy, or 0.
+func (b *nfaBuilder) newLazy(p *Parsed) int {
+	if !p.lazy {
+		return 0
+	}
+	b.numLazy++
+	return b.numLazy
+}
+
+// body builds the operand of the repetition p. Its states are enclosed
+// by the lazy repetition numbered lazy, unless lazy is 0.
+func (b *nfaBuilder) body(p *Parsed, lazy int) *Frag {
+	if lazy == 0 {
+		return b.frag(p.left)
+	}
+	prev := b.lazy
+	b.lazy = append(slices.Clone(prev), lazy)
+	defer func() { b.lazy = prev }()
+	return b.frag(p.left)
+}
+
+func (b *nfaBuilder) frag(p *Parsed) *Frag {
 	switch p.typ {
 	case ParseClass:
 		// -->[class]-->
-		n := &Nfa{class: p.class, caps: p.caps}
+		n := &nfaState{class: NewClass(p.class), caps: p.caps, lazy: b.lazy}
 		return frag(n, &n.next1)
 	case ParseStar:
 		//      V------------\
 		// -->[alt]-->[left]-+
 		//      \------------->
-		left := nfaFrag(p.left)
-		alt := &Nfa{split: true, next2: left.start}
+		// Lazy repetitions prefer the edge that skips left.
+		left := b.body(p, b.newLazy(p))
+		alt, skip := splitTo(left.start, p.lazy)
 		left.outTo(alt)
-		return frag(alt, &alt.next1)
+		return frag(alt, skip)
 	case ParsePlus:
 		// -->[left]-->[alt]-->
 		//      ^-------/
-		left := nfaFrag(p.left)
-		alt := &Nfa{split: true, next2: left.start}
+		left := b.body(p, b.newLazy(p))
+		alt, skip := splitTo(left.start, p.lazy)
 		left.outTo(alt)
-		return frag(left.start, &alt.next1)
+		return frag(left.start, skip)
 	case ParseOpt:
 		// -->[left]-->
 		//  \--------->
-		left := nfaFrag(p.left)
-		alt := &Nfa{split: true, next2: left.start}
-		ends := append(left.ends, &alt.next1)
+		left := b.body(p, b.newLazy(p))
+		alt, skip := splitTo(left.start, p.lazy)
+		ends := append(left.ends, skip)
 		return frag(alt, ends...)
+	case ParseRepeat:
+		// -->[left]-->...-->[left]-->[alt]-->[left]-->[alt]-->[left]-->
+		//      (min copies)           \--------------\------------->
+		// The optional copies are replaced by a star if max is unbounded.
+		var start *nfaState
+		var ends []**nfaState
+		link := func(f *Frag) {
+			if start == nil {
+				start = f.start
+			} else {
+				for _, pEnd := range ends {
+					*pEnd = f.start
+				}
+			}
+			ends = f.ends
+		}
+
+		for range p.min {
+			link(b.frag(p.left))
+		}
+		if p.max < 0 {
+			link(b.frag(&Parsed{typ: ParseStar, left: p.left, lazy: p.lazy}))
+		} else {
+			var skips []**nfaState
+			lazy := b.newLazy(p)
+			for range p.max - p.min {
+				left := b.body(p, lazy)
+				alt, skip := splitTo(left.start, p.lazy)
+				link(frag(alt, left.ends...))
+				skips = append(skips, skip)
+			}
+			ends = append(ends, skips...)
+		}
+
+		if start == nil {
+			// -->[alt]-->
+			// x{0} matches only the empty string.
+			alt := &nfaState{split: true}
+			return frag(alt, &alt.next1, &alt.next2)
+		}
+		return frag(start, ends...)
+	case ParseCap:
+		// -->[save]-->[left]-->[save]-->
+		open := &nfaState{save: true, slot: 2 * p.capNum}
+		left := b.frag(p.left)
+		close := &nfaState{save: true, slot: 2*p.capNum + 1}
+		open.next1 = left.start
+		left.outTo(close)
+		return frag(open, &close.next1)
+	case ParseBegin, ParseEnd:
+		// -->[^]-->
+		n := &nfaState{begin: p.typ == ParseBegin, end: p.typ == ParseEnd}
+		return frag(n, &n.next1)
 	case ParseConcat:
 		// -->[left]-->[right]-->
-		left := nfaFrag(p.left)
-		right := nfaFrag(p.right)
+		left := b.frag(p.left)
+		right := b.frag(p.right)
 		left.outTo(right.start)
 		return frag(left.start, right.ends...)
 	case ParseAlt:
 		// --[alt]-->[left]-->
 		//     \---->[right]-->
-		left := nfaFrag(p.left)
-		right := nfaFrag(p.right)
-		alt := &Nfa{split: true, next1: left.start, next2: right.start}
+		left := b.frag(p.left)
+		right := b.frag(p.right)
+		alt := &nfaState{split: true, next1: left.start, next2: right.start}
 		ends := append(left.ends, right.ends...)
 		return frag(alt, ends...)
 	default:
 		panic(fmt.Errorf("unexpected %v", p))
-		return nil
 	}
 }
 
+// numberNfa gives each state reachable from n a unique id in depth first order.
+// It returns the number of states.
+func numberNfa(n *nfaState) int {
+	nextId := 0
+	visited := make(map[*nfaState]struct{})
+	walk := func(n *nfaState) {}
+	walk = func(n *nfaState) {
+		if n == nil {
+			return
+		}
+		if _, ok := visited[n]; ok {
+			return
+		}
+		visited[n] = struct{}{}
+		n.id = nextId
+		nextId++
+		walk(n.next1)
+		walk(n.next2)
+	}
+	walk(n)
+	return nextId
+}
+
 func MakeNfa(p *Parsed) *Nfa {
-	frag := nfaFrag(p)
-	accept := &Nfa{accept: true}
+	frag := (&nfaBuilder{}).frag(p)
+	accept := &nfaState{accept: true}
 	frag.outTo(accept)
-	return frag.start
+	numberNfa(frag.start)
+	return &Nfa{start: frag.start, groupNames: p.groupNames()}
 }
 
 func NewNfa(re string) (*Nfa, error) {
@@ -156,7 +296,7 @@ func NewNfa(re string) (*Nfa, error) {
 	if err != nil {
 		return nil, err
 	}
-	return MakeNfa(parse), nil
+	return MakeNfa(Simplify(parse)), nil
 }
 
 // compareCaps compares the quality of capture lists.
@@ -177,41 +317,95 @@ func compareCaps(n, m []int) int {
 	return 0
 }
 
+// compareLazy compares the lazy repetitions enclosing two states.
+// It returns zero if they are identical, positive if n is better, and negative if m is better.
+// Better means fewer lazy repetitions, so that characters are matched after a lazy
+// repetition rather than by another repeat of it, and otherwise later ones,
+// since an earlier lazy repetition prefers to leave characters to the ones after it.
+func compareLazy(n, m []int) int {
+	if len(n) != len(m) {
+		return len(m) - len(n)
+	}
+
+	for idx := range n {
+		d := n[idx] - m[idx]
+		if d != 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// anchors is the set of zero-width assertions that hold at an input position.
+type anchors uint8
+
+const (
+	atBegin anchors = 1 << iota
+	atEnd
+)
+
+// anchorsAt returns the assertions that hold at byte offset pos in s.
+func anchorsAt(s string, pos int) anchors {
+	var at anchors
+	if pos == 0 {
+		at |= atBegin
+	}
+	if pos == len(s) {
+		at |= atEnd
+	}
+	return at
+}
+
 // addTargs adds targets that accept characters or are final states
 // while following epsilon edges and avoiding duplicates.
-func addTargs(n *Nfa, visited map[*Nfa]struct{}, l []*Nfa) []*Nfa {
+// Assertions are followed if they hold in at, begin assertions that
+// do not hold are dropped, and end assertions that do not hold are
+// kept as targets in case the input ends here.
+func addTargs(n *nfaState, at anchors, visited map[*nfaState]struct{}, l []*nfaState) []*nfaState {
 	_, ok := visited[n]
 	if !ok {
 		visited[n] = struct{}{}
 		switch {
 		case n.split:
-			l = addTargs(n.next1, visited, l)
-			l = addTargs(n.next2, visited, l)
-		default: // accepting states, and character consuming states.
+			l = addTargs(n.next1, at, visited, l)
+			l = addTargs(n.next2, at, visited, l)
+		case n.begin:
+			if at&atBegin != 0 {
+				l = addTargs(n.next1, at, visited, l)
+			}
+		case n.end && at&atEnd != 0:
+			l = addTargs(n.next1, at, visited, l)
+		case n.save:
+			l = addTargs(n.next1, at, visited, l)
+		default: // accepting states, character consuming states, and pending end assertions.
 			l = append(l, n)
 		}
 	}
 	return l
 }
 
-func advanceEpsilon(n *Nfa) []*Nfa {
-	visited := make(map[*Nfa]struct{})
-	return addTargs(n, visited, nil)
+func advanceEpsilon(n *nfaState, at anchors) []*nfaState {
+	visited := make(map[*nfaState]struct{})
+	return addTargs(n, at, visited, nil)
 }
 
 // pruneNonGreedy goes through a set of nfa states that consume characters,
-// and discards any states that aren't greedy.
-func pruneNonGreedy(ms []*Nfa) []*Nfa {
-	var best []*Nfa
+// and discards any states that aren't greedy, or are repeats of lazy repetitions
+// that could stop instead.
+func pruneNonGreedy(ms []*nfaState) []*nfaState {
+	var best []*nfaState
 	for _, n := range ms {
 		if len(best) == 0 {
-			best = []*Nfa{n}
+			best = []*nfaState{n}
 		} else {
-			d := compareCaps(n.caps, best[0].caps)
+			d := compareLazy(n.lazy, best[0].lazy)
+			if d == 0 {
+				d = compareCaps(n.caps, best[0].caps)
+			}
 			switch {
 			case d > 0: // n is better than everything in the best list.
 				//fmt.Printf("discard %v in favor of %v\n", best, n)
-				best = []*Nfa{n}
+				best = []*nfaState{n}
 			case d == 0: // n belongs on the best list
 				best = append(best, n)
 			case d < 0: // n is not worthy of the best list.
@@ -223,29 +417,45 @@ func pruneNonGreedy(ms []*Nfa) []*Nfa {
 	return best
 }
 
-func advance(ns []*Nfa, ch rune) ([]*Nfa, []int) {
-	var ms []*Nfa
+func advance(ns []*nfaState, ch rune) ([]*nfaState, []int) {
+	var ms []*nfaState
 	for _, n := range ns {
 		switch {
-		case n.split:
+		case n.split, n.begin, n.end, n.save:
 		case n.accept:
 		case n.class.Contains(ch):
 			ms = append(ms, n)
 		}
 	}
 
-	visited := make(map[*Nfa]struct{})
-	var l []*Nfa
+	visited := make(map[*nfaState]struct{})
+	var l []*nfaState
 	var caps []int
 	for _, m := range pruneNonGreedy(ms) {
-		l = addTargs(m.next1, visited, l)
+		l = addTargs(m.next1, 0, visited, l)
 		caps = m.caps
 	}
 
 	return l, caps
 }
 
-func accepts(ns []*Nfa) bool {
+// acceptsAt returns true if ns accepts when the assertions in at hold.
+// Pending end assertions are resolved if at includes atEnd.
+func acceptsAt(ns []*nfaState, at anchors) bool {
+	for _, n := range ns {
+		switch {
+		case n.accept:
+			return true
+		case n.end && at&atEnd != 0:
+			if accepts(advanceEpsilon(n.next1, at)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func accepts(ns []*nfaState) bool {
 	for _, n := range ns {
 		if n.accept {
 			return true
@@ -254,10 +464,55 @@ func accepts(ns []*Nfa) bool {
 	return false
 }
 
+// nfaSearch runs an NFA in findLongest, one NFA state at a time.
+type nfaSearch struct {
+	n *nfaState
+}
+
+// addClosure adds m and the states reachable from it by epsilon edges.
+// Assertions are followed like in addTargs.
+func addClosure(m *nfaState, at anchors, add func(*nfaState) bool) {
+	if !add(m) {
+		return
+	}
+	switch {
+	case m.split:
+		addClosure(m.next1, at, add)
+		addClosure(m.next2, at, add)
+	case m.begin:
+		if at&atBegin != 0 {
+			addClosure(m.next1, at, add)
+		}
+	case m.end && at&atEnd != 0, m.save:
+		addClosure(m.next1, at, add)
+	}
+}
+
+func (ns nfaSearch) start(at anchors, add func(*nfaState) bool) {
+	addClosure(ns.n, at, add)
+}
+
+func (ns nfaSearch) step(m *nfaState, ch rune, add func(*nfaState) bool) {
+	if m.split || m.begin || m.end || m.save || m.accept || !m.class.Contains(ch) {
+		return
+	}
+	addClosure(m.next1, 0, add)
+}
+
+func (nfaSearch) accepting(m *nfaState, at anchors) bool {
+	return acceptsAt([]*nfaState{m}, at)
+}
+
+// FindIndex returns the byte offsets of the leftmost longest match of n in s,
+// or nil if there is no match. The match need not cover all of s.
+func (n *Nfa) FindIndex(s string) []int {
+	return findLongest(nfaSearch{n.start}, s)
+}
+
 func (n *Nfa) Match(s string) ([]string, bool) {
 	capGroups := make(map[int]*strings.Builder)
 	maxGroup := 0
-	ns := advanceEpsilon(n) // follow epsilon edges from start
+	ns := advanceEpsilon(n.start, anchorsAt(s, 0)) // follow epsilon edges from start
 	for pos, ch := range []rune(s) {
 		_ = pos
 		var caps []int
@@ -277,7 +532,7 @@ func (n *Nfa) Match(s string) ([]string, bool) {
 		}
 	}
 
-	if !accepts(ns) {
+	if !acceptsAt(ns, anchorsAt(s, len(s))) {
 		return nil, false
 	}
 
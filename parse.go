@@ -1,13 +1,15 @@
 package tre
 
 import (
+	"errors"
 	"fmt"
 	"slices"
 	"strings"
 	"unicode"
+	"unicode/utf8"
 )
 
-const reservedChars = "\\()[]|*+-"
+const reservedChars = "\\()[]|*+-{"
 
 type ParseType int
 
@@ -20,14 +22,52 @@ const (
 	ParseStar
 	ParsePlus
 	ParseOpt
+	ParseRepeat
+	ParseBegin
+	ParseEnd
+	ParseCap
 )
 
 type Parsed struct {
-	typ   ParseType
-	left  *Parsed
-	right *Parsed
-	class Ranges // ParseClass
-	caps  []int  // ParseClass
+	typ    ParseType
+	left   *Parsed
+	right  *Parsed
+	class  Ranges // ParseClass
+	caps   []int  // ParseClass
+	min    int    // ParseRepeat
+	max    int    // ParseRepeat, -1 if unbounded
+	capNum int    // ParseCap
+	name   string // ParseCap, empty if the group is not named
+	lazy   bool   // ParseStar, ParsePlus, ParseOpt, ParseRepeat
+}
+
+// MaxExpansion limits how many NFA states a counted repetition may expand to.
+var MaxExpansion = 10000
+
+// size returns the number of NFA states that p will expand to.
+func (p *Parsed) size() int {
+	switch p.typ {
+	case ParseClass, ParseBegin, ParseEnd:
+		return 1
+	case ParseConcat:
+		return p.left.size() + p.right.size()
+	case ParseAlt:
+		return 1 + p.left.size() + p.right.size()
+	case ParseStar, ParsePlus, ParseOpt:
+		return 1 + p.left.size()
+	case ParseCap:
+		return 2 + p.left.size()
+	case ParseRepeat:
+		n := p.min * p.left.size()
+		if p.max < 0 {
+			n += 1 + p.left.size()
+		} else {
+			n += (p.max - p.min) * (1 + p.left.size())
+		}
+		return max(n, 1)
+	default:
+		return 0
+	}
 }
 
 func (p *Parsed) Print(indent int) {
@@ -35,6 +75,12 @@ func (p *Parsed) Print(indent int) {
 	switch p.typ {
 	case ParseClass:
 		fmt.Printf("%s%v class=%v caps=%v\n", tab, p.typ, p.class, p.caps)
+	case ParseRepeat:
+		fmt.Printf("%s%v min=%d max=%d lazy=%v\n", tab, p.typ, p.min, p.max, p.lazy)
+	case ParseStar, ParsePlus, ParseOpt:
+		fmt.Printf("%s%v lazy=%v\n", tab, p.typ, p.lazy)
+	case ParseCap:
+		fmt.Printf("%s%v capNum=%d name=%q\n", tab, p.typ, p.capNum, p.name)
 	default:
 		fmt.Printf("%s%v\n", tab, p.typ)
 	}
@@ -85,14 +131,34 @@ func (p *Lexer) advance() {
 		p.pos++
 		p.cur = p.inp[p.pos]
 	} else {
+		p.pos = len(p.inp)
 		p.cur = EOF
 	}
 }
 
+// errorf returns a ParseError with the given code at rune offset pos.
+func (p *Lexer) errorf(pos int, code ErrorCode, format string, args ...any) *ParseError {
+	return &ParseError{
+		Code:       code,
+		Msg:        fmt.Sprintf(format, args...),
+		Pattern:    string(p.inp),
+		Offset:     pos,
+		ByteOffset: len(string(p.inp[:pos])),
+	}
+}
+
 func (p *Lexer) peek() rune {
 	return p.cur
 }
 
+// peek2 returns the rune after the current rune.
+func (p *Lexer) peek2() rune {
+	if p.cur == EOF || p.pos+1 >= len(p.inp) {
+		return EOF
+	}
+	return p.inp[p.pos+1]
+}
+
 func (p *Lexer) next() rune {
 	cur := p.cur
 	p.advance()
@@ -113,8 +179,59 @@ func ParseExpect(p *Lexer, want rune) error {
 	case ch == want:
 		return nil
 	default:
-		return fmt.Errorf("%d: expected %v got %v", pos, showRune(want), showRune(ch))
+		return p.errorf(pos, ErrExpected, "expected %v got %v", showRune(want), showRune(ch))
+	}
+}
+
+// digitVal returns the value of the hex digit ch, or 16 if ch is not a digit.
+func digitVal(ch rune) int {
+	switch {
+	case '0' <= ch && ch <= '9':
+		return int(ch - '0')
+	case 'a' <= ch && ch <= 'f':
+		return int(ch-'a') + 10
+	case 'A' <= ch && ch <= 'F':
+		return int(ch-'A') + 10
+	}
+	return 16
+}
+
+// parseCodePoint parses the digits of a numeric escape starting at pos.
+// The digits are either in braces, or there are exactly n of them.
+// Braces are required if n is 0.
+// codePoint := digit{n} | "{" digit+ "}"
+func parseCodePoint(p *Lexer, pos, base, n int) (rune, error) {
+	braced := p.peek() == '{'
+	if braced || n == 0 {
+		if err := ParseExpect(p, '{'); err != nil {
+			return 0, err
+		}
+	}
+
+	var v, count int
+	for braced || count < n {
+		if braced && p.peek() == '}' && count > 0 {
+			p.advance()
+			break
+		}
+
+		dpos := p.pos
+		ch := p.next()
+		d := digitVal(ch)
+		if d >= base {
+			return 0, p.errorf(dpos, ErrBadCodePoint, "expected base %d digit got %v", base, showRune(ch))
+		}
+		v = v*base + d
+		count++
+		if v > unicode.MaxRune {
+			return 0, p.errorf(pos, ErrBadCodePoint, "code point out of range")
+		}
 	}
+
+	if !utf8.ValidRune(rune(v)) {
+		return 0, p.errorf(pos, ErrBadCodePoint, "code point %U is a surrogate", v)
+	}
+	return rune(v), nil
 }
 
 func parseEscaped(p *Lexer) (rune, error) {
@@ -128,31 +245,191 @@ func parseEscaped(p *Lexer) (rune, error) {
 		return '\r', nil
 	case 'n':
 		return '\n', nil
+	case 't':
+		return '\t', nil
+	case 'f':
+		return '\f', nil
+	case 'v':
+		return '\v', nil
+	case '0':
+		return 0, nil
+	case 'x':
+		return parseCodePoint(p, pos-1, 16, 2)
+	case 'u':
+		return parseCodePoint(p, pos-1, 16, 0)
+	case 'o':
+		return parseCodePoint(p, pos-1, 8, 3)
+	default:
+		return 0, p.errorf(pos-1, ErrBadEscape, "unexpected %v after \\", showRune(ch))
+	}
+}
+
+// escapeClass returns the class of a shorthand class escape \ch,
+// or false if ch does not name a class.
+// Upper case letters name the inverse of the lower case class.
+func escapeClass(ch rune) (Ranges, bool) {
+	var rs Ranges
+	switch ch {
+	case 'd', 'D':
+		rs.Add('0', '9')
+	case 'w', 'W':
+		rs.Add('0', '9')
+		rs.Add('A', 'Z')
+		rs.Add1('_')
+		rs.Add('a', 'z')
+	case 's', 'S':
+		rs.Add('\t', '\n')
+		rs.Add('\f', '\r')
+		rs.Add1(' ')
 	default:
-		return 0, fmt.Errorf("%d: unexpected %v after \\", pos-1, showRune(ch))
+		return nil, false
+	}
+
+	if unicode.IsUpper(ch) {
+		rs = rs.Invert()
+	}
+	return rs, true
+}
+
+// parseUnicodeClass parses the name of a unicode class after \p,
+// which is a single letter or a name in braces.
+// unicodeClass := letter | "{" name "}"
+func parseUnicodeClass(p *Lexer, pos int) (Ranges, error) {
+	var name string
+	if p.peek() == '{' {
+		p.advance()
+		var b strings.Builder
+		for p.peek() != '}' {
+			if p.peek() == EOF {
+				return nil, p.errorf(pos, ErrBadClass, "unterminated unicode class name")
+			}
+			b.WriteRune(p.next())
+		}
+		p.advance()
+		name = b.String()
+	} else {
+		ch := p.next()
+		if ch == EOF {
+			return nil, p.errorf(pos, ErrBadClass, "expected unicode class name got EOF")
+		}
+		name = string(ch)
+	}
+
+	tab, ok := unicode.Categories[name]
+	if !ok {
+		tab, ok = unicode.Scripts[name]
+	}
+	if !ok {
+		return nil, p.errorf(pos, ErrBadClass, "unknown unicode class %q", name)
+	}
+	return tableRanges(tab), nil
+}
+
+// parseEscapeClass parses a class escape such as \d or \p{Greek} if there is one.
+func parseEscapeClass(p *Lexer) (Ranges, bool, error) {
+	if p.peek() != '\\' {
+		return nil, false, nil
+	}
+
+	pos := p.pos
+	switch ch := p.peek2(); ch {
+	case 'p', 'P':
+		p.advance()
+		p.advance()
+		rs, err := parseUnicodeClass(p, pos)
+		if err != nil {
+			return nil, false, err
+		}
+		if ch == 'P' {
+			rs = rs.Invert()
+		}
+		return rs, true, nil
+	}
+
+	rs, ok := escapeClass(p.peek2())
+	if ok {
+		p.advance()
+		p.advance()
+	}
+	return rs, ok, nil
+}
+
+// posixClasses maps the names of POSIX classes to pairs of runes
+// giving the ranges of the class.
+var posixClasses = map[string]string{
+	"alnum":  "09AZaz",
+	"alpha":  "AZaz",
+	"blank":  "\t\t  ",
+	"cntrl":  "\x00\x1f\x7f\x7f",
+	"digit":  "09",
+	"graph":  "!~",
+	"lower":  "az",
+	"print":  " ~",
+	"punct":  "!/:@[`{~",
+	"space":  "\t\r  ",
+	"upper":  "AZ",
+	"xdigit": "09AFaf",
+}
+
+// parsePosixClass parses a POSIX class such as [:alpha:] inside a class if there is one.
+// posixClass := "[:" name ":]"
+func parsePosixClass(p *Lexer) (Ranges, bool, error) {
+	if p.peek() != '[' || p.peek2() != ':' {
+		return nil, false, nil
+	}
+
+	pos := p.pos
+	p.advance()
+	p.advance()
+	var b strings.Builder
+	for p.peek() != ':' {
+		if p.peek() == EOF || p.peek() == ']' {
+			return nil, false, p.errorf(pos, ErrBadClass, "unterminated POSIX class")
+		}
+		b.WriteRune(p.next())
+	}
+	p.advance()
+	if err := ParseExpect(p, ']'); err != nil {
+		return nil, false, err
 	}
+
+	pairs, ok := posixClasses[b.String()]
+	if !ok {
+		return nil, false, p.errorf(pos, ErrBadClass, "unknown POSIX class %q", b.String())
+	}
+	var rs Ranges
+	runes := []rune(pairs)
+	for n := 0; n < len(runes); n += 2 {
+		rs.Add(runes[n], runes[n+1])
+	}
+	return rs, true, nil
 }
 
 func parseClassChar(p *Lexer, terminal rune) (rune, error) {
 	pos := p.pos
-	ch := p.next()
+	ch := p.peek()
 	switch ch {
 	case '\\':
+		p.advance()
 		var err error
 		ch, err = parseEscaped(p)
 		if err != nil {
 			return 0, err
 		}
 	default:
+		// unexpected characters are not consumed, so that
+		// recovery can resync at the end of the class.
 		if ch == EOF || ch == terminal || strings.ContainsRune(reservedChars, ch) || !unicode.IsGraphic(ch) {
-			return 0, fmt.Errorf("%d: unexpected %v", pos, showRune(ch))
+			return 0, p.errorf(pos, ErrUnexpected, "unexpected %v", showRune(ch))
 		}
+		p.advance()
 	}
 	return ch, nil
 }
 
 func parseClassRange(p *Lexer, terminal rune) (rune, rune, error) {
 	defer p.debug("parseReClassRange")()
+	pos := p.pos
 	start, err := parseClassChar(p, terminal)
 	if err != nil {
 		return 0, 0, err
@@ -165,7 +442,7 @@ func parseClassRange(p *Lexer, terminal rune) (rune, rune, error) {
 			return 0, 0, err
 		}
 		if end < start {
-			return 0, 0, fmt.Errorf("class range from %v to %v is empty", showRune(start), showRune(end))
+			return 0, 0, p.errorf(pos, ErrEmptyRange, "class range from %v to %v is empty", showRune(start), showRune(end))
 		}
 		return start, end, nil
 	} else {
@@ -173,7 +450,9 @@ func parseClassRange(p *Lexer, terminal rune) (rune, rune, error) {
 	}
 }
 
-func parseClass(p *Lexer, terminal rune) (Ranges, error) {
+// parseClass parses a character class after the opening bracket.
+// The class is case folded before it is inverted if fold is set.
+func parseClass(p *Lexer, terminal rune, fold bool) (Ranges, error) {
 	defer p.debug("parseReClass")()
 	invert := false
 	if p.peek() == '^' {
@@ -183,6 +462,21 @@ func parseClass(p *Lexer, terminal rune) (Ranges, error) {
 
 	var rs Ranges
 	for p.peek() != ']' {
+		rs2, ok, err := parseEscapeClass(p)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			rs2, ok, err = parsePosixClass(p)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if ok {
+			rs.AddRanges(rs2)
+			continue
+		}
+
 		start, end, err := parseClassRange(p, terminal)
 		if err != nil {
 			return nil, err
@@ -194,6 +488,9 @@ func parseClass(p *Lexer, terminal rune) (Ranges, error) {
 		return nil, err
 	}
 
+	if fold {
+		rs = rs.FoldCase()
+	}
 	if invert {
 		rs = rs.Invert()
 	}
@@ -213,19 +510,245 @@ func parseReChar(p *Lexer, terminal rune) (rune, error) {
 		}
 	default:
 		if ch == EOF || ch == terminal || strings.ContainsRune(reservedChars, ch) || !unicode.IsGraphic(ch) {
-			return 0, fmt.Errorf("%d: Unexpected %v", pos, showRune(ch))
+			return 0, p.errorf(pos, ErrUnexpected, "unexpected %v", showRune(ch))
 		}
 	}
 	return ch, nil
 }
 
+// Flags change how a regular expression is parsed.
+type Flags uint
+
+const (
+	FoldCase Flags = 1 << iota // case insensitive matching, also set by (?i)
+	PCRE                       // PCRE dialect, where ( re ) captures and (?: re ) does not
+)
+
 type Parser struct {
 	capNum  int
 	curCaps []int
+	flags   Flags
+	names   map[string]struct{}
+
+	recover bool          // keep parsing after errors
+	errs    []*ParseError // errors recovered from
+}
+
+// recoverFrom records err and returns true if parser recovers from errors.
+func (parser *Parser) recoverFrom(err error) bool {
+	var perr *ParseError
+	if !parser.recover || !errors.As(err, &perr) {
+		return false
+	}
+	parser.errs = append(parser.errs, perr)
+	return true
+}
+
+// expect is like ParseExpect, but when recovering from errors
+// a missing want is recorded and the input is not consumed.
+func (parser *Parser) expect(lex *Lexer, want rune) error {
+	if parser.recover && lex.peek() != want {
+		parser.errs = append(parser.errs, lex.errorf(lex.pos, ErrExpected, "expected %v got %v", showRune(want), showRune(lex.peek())))
+		return nil
+	}
+	return ParseExpect(lex, want)
+}
+
+// resync skips the input of an atom, starting at save, that failed to parse
+// so that parsing can resume after it. The rest of a group is skipped up to
+// its matching ")", and the rest of a class or repeat up to its "]" or "}".
+// A ")" or terminal that the atom started at is left for the caller,
+// and a repeat is only skipped up to a "|" or ")" that ends the enclosing group.
+// It returns a placeholder for the atom.
+func resync(lex *Lexer, save Lexer, terminal rune) *Parsed {
+	skipTo := func(end rune, stops string) {
+		for ch := lex.peek(); ch != end && ch != terminal && ch != EOF && !strings.ContainsRune(stops, ch); ch = lex.peek() {
+			lex.advance()
+			if ch == '\\' {
+				lex.advance()
+			}
+		}
+		if lex.peek() == end {
+			lex.advance()
+		}
+	}
+
+	switch save.peek() {
+	case ')', terminal, EOF:
+		*lex = save
+	case '[':
+		skipTo(']', "")
+	case '{':
+		skipTo('}', "|)")
+	case '(':
+		depth := 1
+		for ch := lex.peek(); ch != terminal && ch != EOF; ch = lex.peek() {
+			lex.advance()
+			switch ch {
+			case '\\':
+				lex.advance()
+			case '(':
+				depth++
+			case ')':
+				depth--
+			}
+			if depth == 0 {
+				break
+			}
+		}
+	}
+	return &Parsed{typ: ParseErr}
+}
+
+// class returns a class atom for rs with the current flags applied.
+func (parser *Parser) class(rs Ranges) *Parsed {
+	if parser.flags&FoldCase != 0 {
+		rs = rs.FoldCase()
+	}
+	return &Parsed{typ: ParseClass, class: rs, caps: parser.curCaps}
+}
+
+// flagGroup returns the flags and terminator of an inline flag group
+// such as "i)" or "-i:" at the current position of lex, or false if there is none.
+func flagGroup(lex *Lexer) (string, rune, bool) {
+	if lex.peek() == EOF {
+		return "", 0, false
+	}
+	end := lex.pos
+	for end < len(lex.inp) && strings.ContainsRune("i-", lex.inp[end]) {
+		end++
+	}
+	if end == lex.pos || end == len(lex.inp) || (lex.inp[end] != ')' && lex.inp[end] != ':') {
+		return "", 0, false
+	}
+	return string(lex.inp[lex.pos:end]), lex.inp[end], true
+}
+
+// parseFlags parses the flags of an inline flag group up to its terminator
+// and updates the flags of parser.
+// flags := "i"* ("-" "i"*)?
+func parseFlags(parser *Parser, lex *Lexer, flags string) error {
+	pos := lex.pos
+	set, clear, _ := strings.Cut(flags, "-")
+	if (set == "" && clear == "") || strings.Contains(clear, "-") {
+		return lex.errorf(pos, ErrBadFlags, "bad flags %q", flags)
+	}
+	if set != "" {
+		parser.flags |= FoldCase
+	}
+	if clear != "" {
+		parser.flags &^= FoldCase
+	}
+	for range flags {
+		lex.advance()
+	}
+	return nil
+}
+
+// parseFlagGroups parses any inline flag groups that set flags
+// for the rest of the enclosing group, and returns true if there were any.
+// flagGroup := "(?" flags ")"
+func parseFlagGroups(parser *Parser, lex *Lexer) (bool, error) {
+	found := false
+	for lex.peek() == '(' && lex.peek2() == '?' {
+		save := *lex
+		lex.advance()
+		lex.advance()
+		flags, term, ok := flagGroup(lex)
+		if !ok || term != ')' {
+			*lex = save
+			return found, nil
+		}
+		found = true
+		if err := parseFlags(parser, lex, flags); err != nil {
+			if !parser.recoverFrom(err) {
+				return found, err
+			}
+			resync(lex, save, EOF)
+			continue
+		}
+		lex.advance()
+	}
+	return found, nil
+}
+
+// isGroupNameRune returns true if ch can appear in a group name,
+// at its start if first is set.
+func isGroupNameRune(ch rune, first bool) bool {
+	return ch == '_' || unicode.IsLetter(ch) || (!first && unicode.IsDigit(ch))
+}
+
+// parseGroupName parses the name of a named group after "(?".
+// groupName := "<" (letter | "_") (letter | digit | "_")* ">"
+func parseGroupName(parser *Parser, lex *Lexer) (string, error) {
+	pos := lex.pos
+	if err := ParseExpect(lex, '<'); err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	for ch := lex.peek(); isGroupNameRune(ch, b.Len() == 0); ch = lex.peek() {
+		b.WriteRune(lex.next())
+	}
+	if b.Len() == 0 {
+		return "", lex.errorf(lex.pos, ErrBadGroupName, "expected group name got %v", showRune(lex.peek()))
+	}
+	if err := ParseExpect(lex, '>'); err != nil {
+		return "", err
+	}
+
+	name := b.String()
+	if _, ok := parser.names[name]; ok {
+		return "", lex.errorf(pos, ErrBadGroupName, "duplicate group name %q", name)
+	}
+	if parser.names == nil {
+		parser.names = make(map[string]struct{})
+	}
+	parser.names[name] = struct{}{}
+	return name, nil
+}
+
+// parseGroupStart parses the start of a group after the "(" up to its body,
+// and applies the flags of a (?flags: re ) group to parser.
+// It returns true if the group captures, and the name of the group.
+// groupStart := ("?" (flags ":" | groupName)?)?
+// groupStart := ("?" (flags ":" | ":" | "P"? groupName))?     if PCRE is set
+func parseGroupStart(parser *Parser, lex *Lexer) (bool, string, error) {
+	pcre := parser.flags&PCRE != 0
+	if lex.peek() != '?' {
+		return pcre, "", nil
+	}
+	lex.advance()
+
+	if flags, term, ok := flagGroup(lex); ok && term == ':' {
+		// (?flags: re ) only changes the flags inside the group.
+		if err := parseFlags(parser, lex, flags); err != nil {
+			return false, "", err
+		}
+		lex.advance()
+		return false, "", nil
+	}
+
+	switch {
+	case lex.peek() == '<':
+		name, err := parseGroupName(parser, lex)
+		return true, name, err
+	case !pcre:
+		return true, "", nil
+	case lex.peek() == ':':
+		lex.advance()
+		return false, "", nil
+	case lex.peek() == 'P' && lex.peek2() == '<':
+		lex.advance()
+		name, err := parseGroupName(parser, lex)
+		return true, name, err
+	default:
+		return false, "", lex.errorf(lex.pos, ErrUnexpected, "unexpected %v after (?", showRune(lex.peek()))
+	}
 }
 
 // parseReAtom parses an re which is not compound or is parenthesized.
-// reAtom := "." | char | charclass | ( "?"? re )
+// reAtom := "." | "^" | "$" | char | charclass | "(" groupStart re ")"
 func parseReAtom(parser *Parser, lex *Lexer, terminal rune) (*Parsed, error) {
 	defer lex.debug("parseReAtom")()
 	pos := lex.pos
@@ -233,14 +756,17 @@ func parseReAtom(parser *Parser, lex *Lexer, terminal rune) (*Parsed, error) {
 	switch peek {
 	case '(':
 		lex.advance()
-		capNum := 0
-		var prevCaps []int
-		if lex.peek() == '?' {
-			lex.advance()
+		prevFlags := parser.flags
+		capture, name, err := parseGroupStart(parser, lex)
+		if err != nil {
+			return nil, err
+		}
 
+		capNum := 0
+		prevCaps := parser.curCaps
+		if capture {
 			parser.capNum++
 			capNum = parser.capNum
-			prevCaps = parser.curCaps
 			parser.curCaps = append(slices.Clone(prevCaps), capNum)
 		}
 
@@ -248,23 +774,24 @@ func parseReAtom(parser *Parser, lex *Lexer, terminal rune) (*Parsed, error) {
 		if err != nil {
 			return nil, err
 		}
-		if err := ParseExpect(lex, ')'); err != nil {
+		if err := parser.expect(lex, ')'); err != nil {
 			return nil, err
 		}
 
-		if capNum != 0 {
-			parser.curCaps = prevCaps
-			//return &Parsed{typ: ParseCap, left: re1, capNum: capNum}, nil
+		parser.flags = prevFlags
+		parser.curCaps = prevCaps
+		if capture {
+			re1 = &Parsed{typ: ParseCap, left: re1, capNum: capNum, name: name}
 		}
 		return re1, nil
 
-	case '|' | '*' | '+' | '?':
+	case '|', '*', '+', '?', '{':
 		lex.next()
-		return nil, fmt.Errorf("%d: unexpected %v", pos, showRune(peek))
+		return nil, lex.errorf(pos, ErrUnexpected, "unexpected %v", showRune(peek))
 
 	case '[':
 		lex.next()
-		rs, err := parseClass(lex, terminal)
+		rs, err := parseClass(lex, terminal, parser.flags&FoldCase != 0)
 		if err != nil {
 			return nil, err
 		}
@@ -274,35 +801,162 @@ func parseReAtom(parser *Parser, lex *Lexer, terminal rune) (*Parsed, error) {
 		lex.next()
 		return &Parsed{typ: ParseClass, class: FullRanges(), caps: parser.curCaps}, nil
 
+	case '^':
+		lex.next()
+		return &Parsed{typ: ParseBegin}, nil
+
+	case '$':
+		lex.next()
+		return &Parsed{typ: ParseEnd}, nil
+
+	case '\\':
+		rs, ok, err := parseEscapeClass(lex)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return parser.class(rs), nil
+		}
+		fallthrough
+
 	default:
 		ch, err := parseReChar(lex, terminal)
 		if err != nil {
 			return nil, err
 		}
-		return &Parsed{typ: ParseClass, class: newRange1(ch), caps: parser.curCaps}, nil
+		return parser.class(newRange1(ch)), nil
+	}
+}
+
+// parseNum parses a decimal repeat count.
+func parseNum(p *Lexer) (int, error) {
+	pos := p.pos
+	if ch := p.peek(); ch < '0' || ch > '9' {
+		return 0, p.errorf(pos, ErrBadRepeat, "expected digit got %v", showRune(ch))
+	}
+
+	n := 0
+	for ch := p.peek(); '0' <= ch && ch <= '9'; ch = p.peek() {
+		p.advance()
+		n = n*10 + int(ch-'0')
+		if n > MaxExpansion {
+			return 0, p.errorf(pos, ErrBadRepeat, "repeat count too large")
+		}
+	}
+	return n, nil
+}
+
+// parseRepeat parses a counted repetition and returns its min and max counts.
+// The max count is -1 if it is unbounded.
+// repeat := "{" num "}" | "{" num ",}" | "{" num "," num "}"
+func parseRepeat(p *Lexer) (int, int, error) {
+	defer p.debug("parseRepeat")()
+	pos := p.pos
+	if err := ParseExpect(p, '{'); err != nil {
+		return 0, 0, err
+	}
+
+	rmin, err := parseNum(p)
+	if err != nil {
+		return 0, 0, err
+	}
+	rmax := rmin
+	if p.peek() == ',' {
+		p.advance()
+		rmax = -1
+		if p.peek() != '}' {
+			rmax, err = parseNum(p)
+			if err != nil {
+				return 0, 0, err
+			}
+		}
+	}
+
+	if rmax >= 0 && rmax < rmin {
+		return 0, 0, p.errorf(pos, ErrEmptyRange, "repeat range {%d,%d} is empty", rmin, rmax)
+	}
+	if err := ParseExpect(p, '}'); err != nil {
+		return 0, 0, err
+	}
+	return rmin, rmax, nil
+}
+
+// parseLazy parses the "?" that makes a repetition lazy, if there is one.
+func parseLazy(p *Lexer) bool {
+	if p.peek() == '?' {
+		p.advance()
+		return true
 	}
+	return false
 }
 
-// reConcat := reAtom ("*" | "+" | "?") reConcat*
+// atConcatEnd returns true if lex is at the end of a concatenation.
+func atConcatEnd(lex *Lexer, terminal rune) bool {
+	peek := lex.peek()
+	return peek == EOF || peek == terminal || peek == ')' || peek == '|'
+}
+
+// parseReConcat parses a concatenation. Flag groups can appear anywhere in it,
+// and a concatenation of only flag groups matches the empty string.
+// reConcat := flagGroup* reAtom (("*" | "+" | "?" | repeat) "?"?) reConcat* | flagGroup+
 func parseReConcat(parser *Parser, lex *Lexer, terminal rune) (*Parsed, error) {
 	defer lex.debug("parseReConcat")()
-	re1, err := parseReAtom(parser, lex, terminal)
+	flagged, err := parseFlagGroups(parser, lex)
 	if err != nil {
 		return nil, err
 	}
+	if flagged && atConcatEnd(lex, terminal) {
+		return emptyMatch(), nil
+	}
+	save := *lex
+	re1, err := parseReAtom(parser, lex, terminal)
+	if err != nil {
+		if !parser.recoverFrom(err) {
+			return nil, err
+		}
+		re1 = resync(lex, save, terminal)
+	}
 
-	for lex.peek() != EOF && lex.peek() != terminal && lex.peek() != ')' && lex.peek() != '|' {
+	for !atConcatEnd(lex, terminal) {
 		switch lex.peek() {
 		case '*':
 			lex.advance()
-			re1 = &Parsed{typ: ParseStar, left: re1}
+			re1 = &Parsed{typ: ParseStar, left: re1, lazy: parseLazy(lex)}
 		case '+':
 			lex.advance()
-			re1 = &Parsed{typ: ParsePlus, left: re1}
+			re1 = &Parsed{typ: ParsePlus, left: re1, lazy: parseLazy(lex)}
 		case '?':
 			lex.advance()
-			re1 = &Parsed{typ: ParseOpt, left: re1}
+			re1 = &Parsed{typ: ParseOpt, left: re1, lazy: parseLazy(lex)}
+		case '{':
+			pos := lex.pos
+			save := *lex
+			rmin, rmax, err := parseRepeat(lex)
+			if err != nil {
+				if !parser.recoverFrom(err) {
+					return nil, err
+				}
+				resync(lex, save, terminal)
+				continue
+			}
+			rep := &Parsed{typ: ParseRepeat, left: re1, min: rmin, max: rmax, lazy: parseLazy(lex)}
+			if rep.size() > MaxExpansion {
+				err := lex.errorf(pos, ErrBadRepeat, "repetition expands to more than %d states", MaxExpansion)
+				if !parser.recoverFrom(err) {
+					return nil, err
+				}
+				continue
+			}
+			re1 = rep
 		default:
+			// flag groups at the end only change the flags.
+			flagged, err := parseFlagGroups(parser, lex)
+			if err != nil {
+				return nil, err
+			}
+			if flagged && atConcatEnd(lex, terminal) {
+				continue
+			}
 			re2, err := parseReConcat(parser, lex, terminal)
 			if err != nil {
 				return nil, err
@@ -338,7 +992,12 @@ func ParseRe(parser *Parser, lex *Lexer, terminal rune) (*Parsed, error) {
 }
 
 func Parse(s string) (*Parsed, error) {
-	parser := &Parser{}
+	return ParseFlags(s, 0)
+}
+
+// ParseFlags parses a regular expression like Parse with the given flags.
+func ParseFlags(s string, flags Flags) (*Parsed, error) {
+	parser := &Parser{flags: flags}
 	lex := newLexer(s)
 	re, err := ParseRe(parser, lex, EOF)
 	if err != nil {
@@ -351,6 +1010,38 @@ func Parse(s string) (*Parsed, error) {
 	return re, nil
 }
 
+// ParseRecover parses a regular expression like ParseFlags, but instead of
+// stopping at the first error it resyncs after each error and returns all
+// of them. It returns nil and the errors if there were any.
+func ParseRecover(s string, flags Flags) (*Parsed, []*ParseError) {
+	parser := &Parser{flags: flags, recover: true}
+	lex := newLexer(s)
+	re, err := ParseRe(parser, lex, EOF)
+	for err == nil && lex.peek() != EOF {
+		// a ")" without a matching "(", parsing resumes after it.
+		pos := lex.pos
+		ch := lex.next()
+		parser.errs = append(parser.errs, lex.errorf(pos, ErrExpected, "expected %v got %v", showRune(EOF), showRune(ch)))
+		if lex.peek() != EOF {
+			var re2 *Parsed
+			re2, err = ParseRe(parser, lex, EOF)
+			re = &Parsed{typ: ParseConcat, left: re, right: re2}
+		}
+	}
+	if err != nil {
+		var perr *ParseError
+		if !errors.As(err, &perr) {
+			perr = lex.errorf(lex.pos, ErrUnexpected, "%v", err)
+		}
+		parser.errs = append(parser.errs, perr)
+	}
+
+	if len(parser.errs) > 0 {
+		return nil, parser.errs
+	}
+	return re, nil
+}
+
 // ParseBounded parses an RE that is bounded by punctuation, such as /re/.
 func ParseBounded(s string) (*Parsed, error) {
 	parser := &Parser{}
@@ -359,7 +1050,7 @@ func ParseBounded(s string) (*Parsed, error) {
 	pos := lex.pos
 	terminal := lex.next()
 	if terminal == EOF || !unicode.IsPunct(terminal) {
-		return nil, fmt.Errorf("%d: unexpected bounding character %v", pos, showRune(terminal))
+		return nil, lex.errorf(pos, ErrUnexpected, "unexpected bounding character %v", showRune(terminal))
 	}
 
 	re, err := ParseRe(parser, lex, terminal)
@@ -15,11 +15,15 @@ func _() {
 	_ = x[ParseStar-4]
 	_ = x[ParsePlus-5]
 	_ = x[ParseOpt-6]
+	_ = x[ParseRepeat-7]
+	_ = x[ParseBegin-8]
+	_ = x[ParseEnd-9]
+	_ = x[ParseCap-10]
 }
 
-const _ParseType_name = "ParseErrParseClassParseConcatParseAltParseStarParsePlusParseOpt"
+const _ParseType_name = "ParseErrParseClassParseConcatParseAltParseStarParsePlusParseOptParseRepeatParseBeginParseEndParseCap"
 
-var _ParseType_index = [...]uint8{0, 8, 18, 29, 37, 46, 55, 63}
+var _ParseType_index = [...]uint8{0, 8, 18, 29, 37, 46, 55, 63, 74, 84, 92, 100}
 
 func (i ParseType) String() string {
 	idx := int(i) - 0
@@ -0,0 +1,138 @@
+package tre
+
+import (
+	"slices"
+	"unicode/utf8"
+)
+
+// thread is a Pike VM thread: an NFA state and the capture slots
+// recorded on the way to it.
+type thread struct {
+	n     *nfaState
+	slots []int
+}
+
+// numSlots returns the number of capture slots used by the NFA starting at n,
+// including the two slots for the overall match.
+func (n *nfaState) numSlots() int {
+	nslots := 2
+	visited := make(map[*nfaState]struct{})
+	walk := func(n *nfaState) {}
+	walk = func(n *nfaState) {
+		if n == nil {
+			return
+		}
+		if _, ok := visited[n]; ok {
+			return
+		}
+		visited[n] = struct{}{}
+		if n.save {
+			nslots = max(nslots, n.slot+1)
+		}
+		walk(n.next1)
+		walk(n.next2)
+	}
+	walk(n)
+	return nslots
+}
+
+// addThread adds a thread for n to l in priority order, following epsilon
+// edges and recording positions in save states. Assertions are followed
+// if they hold in at. Only the first thread to reach each state is kept.
+func addThread(l []thread, n *nfaState, pos int, at anchors, slots []int, visited map[*nfaState]struct{}) []thread {
+	if _, ok := visited[n]; ok {
+		return l
+	}
+	visited[n] = struct{}{}
+
+	switch {
+	case n.split:
+		l = addThread(l, n.next1, pos, at, slots, visited)
+		l = addThread(l, n.next2, pos, at, slots, visited)
+	case n.begin:
+		if at&atBegin != 0 {
+			l = addThread(l, n.next1, pos, at, slots, visited)
+		}
+	case n.end:
+		if at&atEnd != 0 {
+			l = addThread(l, n.next1, pos, at, slots, visited)
+		}
+	case n.save:
+		slots = slices.Clone(slots)
+		slots[n.slot] = pos
+		l = addThread(l, n.next1, pos, at, slots, visited)
+	default: // accepting states, and character consuming states.
+		l = append(l, thread{n, slots})
+	}
+	return l
+}
+
+// pike runs a Pike VM simulation of n over s and returns the capture slots
+// of the highest priority match, or nil if there is no match.
+// If search is false the match must cover all of s, otherwise the
+// leftmost match is found.
+func (n *Nfa) pike(s string, search bool) []int {
+	nslots := n.start.numSlots()
+	newThread := func(l []thread, pos int, visited map[*nfaState]struct{}) []thread {
+		slots := make([]int, nslots)
+		for i := range slots {
+			slots[i] = -1
+		}
+		slots[0] = pos
+		return addThread(l, n.start, pos, anchorsAt(s, pos), slots, visited)
+	}
+
+	var matched []int
+	clist := newThread(nil, 0, make(map[*nfaState]struct{}))
+	for pos := 0; len(clist) > 0 || (search && matched == nil); {
+		var ch rune
+		w := 0
+		if pos < len(s) {
+			ch, w = utf8.DecodeRuneInString(s[pos:])
+		}
+
+		visited := make(map[*nfaState]struct{})
+		var nlist []thread
+	step:
+		for _, th := range clist {
+			switch {
+			case th.n.accept:
+				if !search && pos < len(s) {
+					continue
+				}
+				// lower priority threads are cut off by this match.
+				matched = slices.Clone(th.slots)
+				matched[1] = pos
+				break step
+			case th.n.split, th.n.begin, th.n.end, th.n.save:
+			case w > 0 && th.n.class.Contains(ch):
+				nlist = addThread(nlist, th.n.next1, pos+w, anchorsAt(s, pos+w), th.slots, visited)
+			}
+		}
+
+		if pos == len(s) {
+			break
+		}
+		pos += w
+		if search && matched == nil {
+			nlist = newThread(nlist, pos, visited)
+		}
+		clist = nlist
+	}
+	return matched
+}
+
+// SubmatchIndex matches n against all of s and returns the byte offsets of
+// the match and of each capture group, in the same form as
+// regexp.FindSubmatchIndex. Groups that did not take part in the match
+// are -1, and a group that matched several times reports its last match.
+// It returns nil if there is no match.
+func (n *Nfa) SubmatchIndex(s string) []int {
+	return n.pike(s, false)
+}
+
+// FindSubmatchIndex is like SubmatchIndex, but returns the leftmost match in s.
+// Alternatives are preferred from left to right, and repetitions are greedy.
+func (n *Nfa) FindSubmatchIndex(s string) []int {
+	return n.pike(s, true)
+}
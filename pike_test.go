@@ -0,0 +1,80 @@
+package tre
+
+import (
+	"testing"
+
+	"github.com/alecthomas/assert"
+)
+
+func TestSubmatchIndex(t *testing.T) {
+	tests := []struct {
+		pat  string
+		s    string
+		want []int
+	}{
+		{"a", "a", []int{0, 1}},
+		{"a", "b", nil},
+		{"he(?ll)o(?a*)", "helloaaa", []int{0, 8, 2, 4, 5, 8}},
+
+		// the last iteration of a repeated group wins.
+		{"(?a)*", "aaa", []int{0, 3, 2, 3}},
+		{"(?a|b)+c", "abbc", []int{0, 4, 2, 3}},
+		{"(?[a-z]{2})+", "abcdef", []int{0, 6, 4, 6}},
+
+		// groups that dont participate are -1.
+		{"(?a)|(?b)", "b", []int{0, 1, -1, -1, 0, 1}},
+		{"(?a)*", "", []int{0, 0, -1, -1}},
+
+		// nested groups.
+		{"(?a(?b)*)*", "abbab", []int{0, 5, 3, 5, 4, 5}},
+
+		// alternatives are preferred left to right, repetitions are greedy.
+		{"(?a|ab)(?c|bcd)(?d*)", "abcd", []int{0, 4, 0, 1, 1, 4, 4, 4}},
+		{"a(?a*)ab", "aaaab", []int{0, 5, 1, 3}},
+
+		{"^(?é+)$", "ééé", []int{0, 6, 0, 6}},
+
+		// lazy repetitions prefer fewer iterations.
+		{"(?a*?)(?a*)", "aaa", []int{0, 3, 0, 0, 0, 3}},
+		{"(?a+?)(?a*)", "aaa", []int{0, 3, 0, 1, 1, 3}},
+		{"(?a??)(?a*)", "aaa", []int{0, 3, 0, 0, 0, 3}},
+		{"(?a{1,3}?)(?a*)", "aaa", []int{0, 3, 0, 1, 1, 3}},
+		{"(?a{2,}?)(?a*)", "aaaa", []int{0, 4, 0, 2, 2, 4}},
+		{"(?a*?)b", "aab", []int{0, 3, 0, 2}},
+	}
+
+	for _, test := range tests {
+		nfa, err := NewNfa(test.pat)
+		assert.NoError(t, err)
+		assert.Equal(t, nfa.SubmatchIndex(test.s), test.want, "%q %q", test.pat, test.s)
+	}
+}
+
+func TestFindSubmatchIndex(t *testing.T) {
+	tests := []struct {
+		pat  string
+		s    string
+		want []int
+	}{
+		{"b+", "aabbbcc", []int{2, 5}},
+		{"x", "aabbbcc", nil},
+		{"$", "abc", []int{3, 3}},
+		{"^b", "ab", nil},
+
+		// leftmost-first, not leftmost-longest.
+		{"ab|abcd", "xxabcde", []int{2, 4}},
+		{"(?[0-9]+)\\-(?[0-9]+)", "port 80-443 open", []int{5, 11, 5, 7, 8, 11}},
+		{"\\\"(?[^\\\"]*)\\\"", "say \"a\" and \"b\"", []int{4, 7, 5, 6}},
+
+		// lazy repetitions stop at the first possible match.
+		{"\"(?.*?)\"", "say \"a\" and \"b\"", []int{4, 7, 5, 6}},
+		{"\"(?.*)\"", "say \"a\" and \"b\"", []int{4, 15, 5, 14}},
+		{"a+?", "xaaa", []int{1, 2}},
+	}
+
+	for _, test := range tests {
+		nfa, err := NewNfa(test.pat)
+		assert.NoError(t, err)
+		assert.Equal(t, nfa.FindSubmatchIndex(test.s), test.want, "%q %q", test.pat, test.s)
+	}
+}
@@ -2,7 +2,10 @@ package tre
 
 import (
 	"fmt"
+	"slices"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 type Range struct {
@@ -72,9 +75,15 @@ func (rs Ranges) String() string {
 }
 
 func (rs Ranges) Contains(v rune) bool {
-	// TODO: binary search for efficiency
-	for _, r := range rs {
-		if r.Contains(v) {
+	lo, hi := 0, len(rs)
+	for lo < hi {
+		mid := int(uint(lo+hi) >> 1)
+		switch {
+		case rs[mid].rmax < v:
+			lo = mid + 1
+		case v < rs[mid].rmin:
+			hi = mid
+		default:
 			return true
 		}
 	}
@@ -110,6 +119,49 @@ func (rs *Ranges) Add(rmin, rmax rune) {
 	*rs = append(append(before, Range{rmin, rmax}), after...)
 }
 
+// tableRanges returns the characters in tab.
+func tableRanges(tab *unicode.RangeTable) Ranges {
+	var rs Ranges
+	add := func(lo, hi, stride rune) {
+		if stride == 1 {
+			rs.Add(lo, hi)
+			return
+		}
+		for ch := lo; ch <= hi; ch += stride {
+			rs.Add1(ch)
+		}
+	}
+	for _, r := range tab.R16 {
+		add(rune(r.Lo), rune(r.Hi), rune(r.Stride))
+	}
+	for _, r := range tab.R32 {
+		add(rune(r.Lo), rune(r.Hi), rune(r.Stride))
+	}
+	return rs
+}
+
+// minFold and maxFold bound the characters that have other cases.
+const (
+	minFold rune = 'A'
+	maxFold rune = 0x1e943
+)
+
+// FoldCase returns rs with the simple case folding orbit of each of its
+// characters added, so that it matches characters in any case.
+func (rs Ranges) FoldCase() Ranges {
+	folded := slices.Clone(rs)
+	for _, r := range rs {
+		for ch := max(r.rmin, minFold); ch <= min(r.rmax, maxFold); ch++ {
+			for f := unicode.SimpleFold(ch); f != ch; f = unicode.SimpleFold(f) {
+				if !folded.Contains(f) {
+					folded.Add1(f)
+				}
+			}
+		}
+	}
+	return folded
+}
+
 func (rs *Ranges) AddRanges(rs2 Ranges) {
 	for _, r := range rs2 {
 		rs.Add(r.rmin, r.rmax)
@@ -202,3 +254,44 @@ func Diff(as, bs Ranges) (Ranges, Ranges, Ranges) {
 
 	return onlyA, both, onlyB
 }
+
+// Class is an immutable character class that is precompiled for matching.
+// ASCII characters are looked up in a bitmap, and other characters
+// with a binary search of the ranges.
+type Class struct {
+	ascii  [2]uint64 // bit ch is set if ASCII character ch is in the class
+	ranges Ranges
+}
+
+func NewClass(rs Ranges) Class {
+	c := Class{ranges: slices.Clone(rs)}
+	for _, r := range rs {
+		for ch := max(r.rmin, 0); ch <= r.rmax && ch < utf8.RuneSelf; ch++ {
+			c.ascii[ch/64] |= 1 << (ch % 64)
+		}
+	}
+	return c
+}
+
+func (c Class) String() string {
+	return c.ranges.String()
+}
+
+// Ranges returns a copy of the ranges of c.
+func (c Class) Ranges() Ranges {
+	return slices.Clone(c.ranges)
+}
+
+func (c Class) Contains(v rune) bool {
+	if 0 <= v && v < utf8.RuneSelf {
+		return c.ascii[v/64]&(1<<(v%64)) != 0
+	}
+	return c.ranges.Contains(v)
+}
+
+// Union returns a class with the characters of c and rs.
+func (c Class) Union(rs Ranges) Class {
+	union := slices.Clone(c.ranges)
+	union.AddRanges(rs)
+	return NewClass(union)
+}
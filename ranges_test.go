@@ -1,7 +1,9 @@
 package tre
 
 import (
+	"fmt"
 	"testing"
+	"unicode"
 
 	"github.com/alecthomas/assert"
 )
@@ -90,3 +92,121 @@ func TestRanges(t *testing.T) {
 		buildRanges(t, "a", "r", "x"))
 
 }
+
+// containsLinear is Ranges.Contains without the binary search.
+func containsLinear(rs Ranges, v rune) bool {
+	for _, r := range rs {
+		if r.Contains(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// sparseRanges returns n single character ranges spread out from start.
+func sparseRanges(start rune, n int) Ranges {
+	var rs Ranges
+	for k := range n {
+		rs.Add1(start + rune(3*k))
+	}
+	return rs
+}
+
+func TestContains(t *testing.T) {
+	classes := []Ranges{
+		buildRanges(t),
+		buildRanges(t, "a"),
+		append(buildRanges(t, "09", "az"), Range{'é', 'ü'}),
+		buildRanges(t, "az").Invert(),
+		FullRanges(),
+		sparseRanges(100, 100),
+		sparseRanges(100, 100).Invert(),
+	}
+
+	for _, rs := range classes {
+		c := NewClass(rs)
+		assert.Equal(t, c.String(), rs.String())
+		for v := rune(-1); v < 500; v++ {
+			want := containsLinear(rs, v)
+			assert.Equal(t, rs.Contains(v), want, "%v %d", rs, v)
+			assert.Equal(t, c.Contains(v), want, "%v %d", rs, v)
+		}
+		assert.True(t, rs.Contains(maxRune) == c.Contains(maxRune))
+	}
+}
+
+func TestTableRanges(t *testing.T) {
+	for _, tab := range []*unicode.RangeTable{unicode.L, unicode.Lu, unicode.Nd, unicode.Greek, unicode.Han} {
+		rs := tableRanges(tab)
+		for v := rune(0); v <= unicode.MaxRune; v++ {
+			if rs.Contains(v) != unicode.Is(tab, v) {
+				t.Fatalf("%U: got %v", v, rs.Contains(v))
+			}
+		}
+	}
+}
+
+func TestFoldCase(t *testing.T) {
+	expectRanges(t, "[A-Za-z\u017f\u212a]", buildRanges(t, "az").FoldCase())
+	expectRanges(t, "[0-9]", buildRanges(t, "09").FoldCase())
+	expectRanges(t, "[Kk\u212a]", buildRanges(t, "K").FoldCase())
+
+	// the inverse of a folded class is also folded.
+	inv := buildRanges(t, "k").FoldCase().Invert()
+	assert.Equal(t, inv.FoldCase(), inv)
+}
+
+func TestClassUnion(t *testing.T) {
+	rs := buildRanges(t, "ac")
+	c := NewClass(rs)
+	c2 := c.Union(append(buildRanges(t, "x"), Range{'é', 'é'}))
+	assert.Equal(t, c.String(), "[a-c]")
+	assert.Equal(t, c2.String(), "[a-cxé]")
+	assert.True(t, c2.Contains('x'))
+	assert.False(t, c.Contains('x'))
+
+	// classes don't share ranges with their callers.
+	rs.Add1('z')
+	crs := c.Ranges()
+	crs[0].rmax = 'y'
+
+	assert.False(t, c.Contains('z'))
+	assert.False(t, c.Contains('y'))
+}
+
+func BenchmarkContains(b *testing.B) {
+	classes := []struct {
+		name string
+		rs   Ranges
+	}{
+		{"small", newRange('a', 'z')},
+		{"sparse", sparseRanges(0x100, 1000)},
+		{"inverted", sparseRanges(0x20, 1000).Invert()},
+	}
+	probes := []rune{'a', 'q', '~', 0x101, 0x900, 0x4e16}
+
+	for _, class := range classes {
+		c := NewClass(class.rs)
+		b.Run(fmt.Sprintf("%s/linear", class.name), func(b *testing.B) {
+			for b.Loop() {
+				for _, v := range probes {
+					containsLinear(class.rs, v)
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("%s/ranges", class.name), func(b *testing.B) {
+			for b.Loop() {
+				for _, v := range probes {
+					class.rs.Contains(v)
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("%s/class", class.name), func(b *testing.B) {
+			for b.Loop() {
+				for _, v := range probes {
+					c.Contains(v)
+				}
+			}
+		})
+	}
+}
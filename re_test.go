@@ -1,7 +1,9 @@
 package tre
 
 import (
+	"errors"
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/alecthomas/assert"
@@ -69,6 +71,21 @@ func matchDfa(t *testing.T, pat, s string, wantMatch bool, wantGroups ...string)
 	match(t, mach, s, wantMatch, wantGroups...)
 }
 
+func matchDfaTable(t *testing.T, pat, s string, wantMatch bool, wantGroups ...string) {
+	//t.Helper()
+	dfa, err := NewDfa(pat)
+	assert.NoError(t, err)
+	match(t, dfa.Compile(), s, wantMatch, wantGroups...)
+}
+
+func matchLazyDfa(t *testing.T, pat, s string, wantMatch bool, wantGroups ...string) {
+	//t.Helper()
+	nfa, err := NewNfa(pat)
+	assert.NoError(t, err)
+	// a tiny cache exercises flushing and falling back to the NFA.
+	match(t, MakeLazyDfa(nfa, 3), s, wantMatch, wantGroups...)
+}
+
 func expectMatch(t *testing.T, match matchFunc, pat, s string, wantGroups ...string) {
 	//t.Helper()
 	ok := false
@@ -98,6 +115,8 @@ func TestRe(t *testing.T) {
 	}{
 		{"nfa-match", matchNfa},
 		{"dfa-match", matchDfa},
+		{"dfa-table-match", matchDfaTable},
+		{"lazy-dfa-match", matchLazyDfa},
 	}
 
 	for _, test := range matchers {
@@ -173,6 +192,352 @@ func TestRe(t *testing.T) {
 
 			// greedy matching should make this match fail because all the a's are in the group.
 			expectNoMatch(t, m, "a(?a*)ab", "aaaab")
+
+			// counted repetition
+			expectMatch(t, m, "[0-9]{4}", "2024")
+			expectNoMatch(t, m, "[0-9]{4}", "202")
+			expectNoMatch(t, m, "[0-9]{4}", "20245")
+			expectMatch(t, m, "a{2,}", "aa")
+			expectMatch(t, m, "a{2,}", "aaaaa")
+			expectNoMatch(t, m, "a{2,}", "a")
+			expectNoMatch(t, m, "a{2,3}", "a")
+			expectMatch(t, m, "a{2,3}", "aa")
+			expectMatch(t, m, "a{2,3}", "aaa")
+			expectNoMatch(t, m, "a{2,3}", "aaaa")
+			expectMatch(t, m, "a{0,2}", "")
+			expectMatch(t, m, "xa{0}y", "xy")
+			expectNoMatch(t, m, "xa{0}y", "xay")
+			expectMatch(t, m, "(ab){2}c", "ababc")
+			expectMatch(t, m, "x(?a{1,2})b", "xaab", "aa")
+			expectMatch(t, m, "\\{a}[\\{]", "{a}{")
+
+			// anchors
+			expectMatch(t, m, "^a$", "a")
+			expectMatch(t, m, "^$", "")
+			expectMatch(t, m, "$^", "")
+			expectMatch(t, m, "(^a|b)c", "bc")
+			expectNoMatch(t, m, "a^b", "ab")
+			expectNoMatch(t, m, "a$b", "ab")
+			expectMatch(t, m, "a(b$|c)*", "acb")
+			expectNoMatch(t, m, "a(b$|c)*", "abc")
+
+			// shorthand classes
+			expectMatch(t, m, "\\d+", "2024")
+			expectNoMatch(t, m, "\\d", "x")
+			expectMatch(t, m, "\\D", "x")
+			expectNoMatch(t, m, "\\D", "7")
+			expectMatch(t, m, "\\w+", "snake_Case9")
+			expectNoMatch(t, m, "\\w", "-")
+			expectMatch(t, m, "\\W", "é")
+			expectMatch(t, m, "a\\sb", "a\tb")
+			expectNoMatch(t, m, "a\\Sb", "a b")
+			expectMatch(t, m, "[\\d.]+", "3.14")
+			expectMatch(t, m, "[a-f\\d]+", "c0ffee")
+			expectNoMatch(t, m, "[^\\s\\d]", "1")
+			expectMatch(t, m, "[^\\s\\d]", "x")
+			expectMatch(t, m, "[\\D]", "x")
+			expectNoMatch(t, m, "[^\\D]", "x")
+
+			// unicode classes
+			expectMatch(t, m, "\\p{L}+", "héllo")
+			expectNoMatch(t, m, "\\p{L}", "1")
+			expectMatch(t, m, "\\pL\\pN", "ж٣")
+			expectMatch(t, m, "\\p{Greek}+", "αβγ")
+			expectNoMatch(t, m, "\\p{Greek}", "a")
+			expectMatch(t, m, "\\P{Greek}", "a")
+			expectNoMatch(t, m, "\\P{Greek}", "α")
+			expectMatch(t, m, "[\\p{Nd}a-f]+", "4a٣")
+			expectMatch(t, m, "[^\\p{Lu}]", "a")
+			expectNoMatch(t, m, "[^\\p{Lu}]", "Ж")
+			expectNoMatch(t, m, "[^\\P{Lu}]", "a")
+
+			// POSIX classes
+			expectMatch(t, m, "[[:digit:]]+", "2024")
+			expectNoMatch(t, m, "[[:digit:]]", "x")
+			expectMatch(t, m, "[[:alpha:][:digit:]_]+", "ab_12")
+			expectMatch(t, m, "[^[:space:]]+", "abc")
+			expectNoMatch(t, m, "[^[:space:]]", "\t")
+			expectMatch(t, m, "x[[:space:]]y", "x\vy")
+			expectMatch(t, m, "[[:punct:]]", "@")
+			expectNoMatch(t, m, "[[:punct:]]", "a")
+
+			// control and numeric escapes
+			expectMatch(t, m, "a\\tb", "a\tb")
+			expectMatch(t, m, "\\f\\v\\0", "\f\v\x00")
+			expectMatch(t, m, "\\x41\\x{1F600}\\u{e9}", "A😀é")
+			expectMatch(t, m, "\\o101\\o{0}", "A\x00")
+			expectMatch(t, m, "[\\x00-\\x1f]+", "\x01\x1f")
+			expectNoMatch(t, m, "[\\x00-\\x1f]", " ")
+
+			// case folding
+			expectMatch(t, m, "(?i)hello", "HeLLo")
+			expectNoMatch(t, m, "hello", "HELLO")
+			expectMatch(t, m, "a(?i)b", "aB")
+			expectNoMatch(t, m, "a(?i)b", "AB")
+			expectMatch(t, m, "(?i)a(?-i)b", "Ab")
+			expectNoMatch(t, m, "(?i)a(?-i)b", "AB")
+			expectMatch(t, m, "(a(?i)b)c", "aBc")
+			expectNoMatch(t, m, "(a(?i)b)c", "aBC")
+			expectMatch(t, m, "(?i:ab)c", "ABc")
+			expectNoMatch(t, m, "(?i:ab)c", "ABC")
+			expectMatch(t, m, "(?i)[a-c]+", "aBC")
+			expectMatch(t, m, "(?i)[^a]", "b")
+			expectNoMatch(t, m, "(?i)[^a]", "A")
+			expectMatch(t, m, "(?i)k", "\u212a")
+			expectMatch(t, m, "(?i)\\p{Lu}", "ж")
+			expectMatch(t, m, "(?i)(?x)y", "XY", "X")
+			// flag groups at the end of a pattern or group match the empty string.
+			expectMatch(t, m, "a(?i)", "a")
+			expectMatch(t, m, "(?i)", "")
+			expectNoMatch(t, m, "(?i)", "i")
+			expectMatch(t, m, "(a(?i))b", "ab")
+			expectMatch(t, m, "((?i)|b)c", "c")
+			expectMatch(t, m, "a(?i)|b", "B")
+			// lazy repetition matches the same strings.
+			expectMatch(t, m, "a*?b", "aab")
+			expectMatch(t, m, "a+?", "aaa")
+			expectNoMatch(t, m, "a+?", "")
+			expectMatch(t, m, "xa??y", "xy")
+			expectNoMatch(t, m, "xa??y", "xaay")
+			// and captures prefer fewer repeats.
+			expectMatch(t, m, "(?a*?)(?a*)", "aaa", "", "aaa")
+			expectMatch(t, m, "(?a+?)(?a*)", "aaa", "a", "aa")
+			expectMatch(t, m, "\"(?.*?)\".*", "\"a\" and \"b\"", "a")
+			expectMatch(t, m, "(?a*?)b", "aab", "aa")
+			expectMatch(t, m, "a{1,2}?b", "aab")
+			expectMatch(t, m, "a**", "aa")
+		}
+	}
+}
+
+func TestEscapeClasses(t *testing.T) {
+	tests := []struct {
+		pat  string
+		want string
+	}{
+		{"\\d", "[0-9]"},
+		{"\\w", "[0-9A-Z_a-z]"},
+		{"\\s", "[\\t-\\n\\f-\\r ]"},
+		{"[\\dx-z]", "[0-9x-z]"},
+		{"[^\\W]", "[0-9A-Z_a-z]"},
+		{"[[:alnum:]]", "[0-9A-Za-z]"},
+		{"[[:blank:]]", "[\\t ]"},
+		{"[[:cntrl:]]", "[\\x00-\\x1f\\x7f]"},
+		{"[[:graph:]]", "[!-~]"},
+		{"[[:lower:]]", "[a-z]"},
+		{"[[:print:]]", "[ -~]"},
+		{"[[:punct:]]", "[!-/:-@[-`{-~]"},
+		{"[[:space:]]", "[\\t-\\r ]"},
+		{"[[:upper:][:xdigit:]]", "[0-9A-Za-f]"},
+	}
+	for _, test := range tests {
+		p, err := Parse(test.pat)
+		assert.NoError(t, err, test.pat)
+		assert.Equal(t, p.class.String(), test.want, test.pat)
+	}
+
+	for _, pat := range []string{"\\q", "[\\d-z]", "[a-\\d]", "\\", "\\p", "\\p{L", "\\p{Klingon}", "[\\P{}]", "[[:alpha]]", "[[:foo:]]", "[[:alpha:]"} {
+		_, err := Parse(pat)
+		assert.Error(t, err, pat)
+	}
+}
+
+func TestNumericEscapes(t *testing.T) {
+	tests := []struct {
+		pat  string
+		want rune
+	}{
+		{"\\x7f", 0x7f},
+		{"\\xfF", 0xff},
+		{"\\x{10FFFF}", 0x10ffff},
+		{"\\u{0}", 0},
+		{"\\o377", 0xff},
+		{"[\\u{3b1}]", 'α'},
+	}
+	for _, test := range tests {
+		p, err := Parse(test.pat)
+		assert.NoError(t, err, test.pat)
+		assert.Equal(t, p.class, newRange1(test.want), test.pat)
+	}
+
+	errors := []struct {
+		pat string
+		err string
+	}{
+		{"\\x4", "3: expected base 16 digit got EOF"},
+		{"\\xg0", "2: expected base 16 digit got 'g'"},
+		{"\\x{}", "3: expected base 16 digit got '}'"},
+		{"\\x{110000}", "0: code point out of range"},
+		{"a\\u{FFFFFFFFFF}", "1: code point out of range"},
+		{"\\u{D800}", "0: code point U+D800 is a surrogate"},
+		{"\\u41", "2: expected '{' got '4'"},
+		{"\\o18", "3: expected base 8 digit got '8'"},
+	}
+	for _, test := range errors {
+		_, err := Parse(test.pat)
+		assert.EqualError(t, err, test.err, test.pat)
+	}
+}
+
+func TestLazyNeverFires(t *testing.T) {
+	// a lazy repetition that never matches anything doesn't change the result.
+	pats := []string{"a(?a*)ab", "(?a|ab)(?b*)", "(?a*)(?a+)b?", "((?a)|b)*(?b*)"}
+	for _, pat := range pats {
+		for _, lazyPat := range []string{pat + "c*?", "c??" + pat} {
+			nfa, err := NewNfa(pat)
+			assert.NoError(t, err)
+			lazyNfa, err := NewNfa(lazyPat)
+			assert.NoError(t, err)
+			lazyDfa := MakeDfa(lazyNfa)
+			machines := []Matcher{lazyNfa, lazyDfa, lazyDfa.Compile(), MakeLazyDfa(lazyNfa, 3)}
+			for _, s := range allStrings("ab", 5) {
+				groups, match := nfa.Match(s)
+				for _, m := range machines {
+					lazyGroups, lazyMatch := m.Match(s)
+					assert.Equal(t, lazyMatch, match, "%q %q", lazyPat, s)
+					assert.Equal(t, lazyGroups, groups, "%q %q", lazyPat, s)
+				}
+			}
+		}
+	}
+}
+
+func TestFoldCaseFlag(t *testing.T) {
+	p, err := ParseFlags("straße|[x-z]", FoldCase)
+	assert.NoError(t, err)
+	nfa := MakeNfa(p)
+	dfa := MakeDfa(nfa)
+	for _, s := range []string{"STRASSE", "Straße", "STRAẞE", "Y"} {
+		_, nfaMatch := nfa.Match(s)
+		_, dfaMatch := dfa.Match(s)
+		assert.Equal(t, nfaMatch, s != "STRASSE", s)
+		assert.Equal(t, dfaMatch, nfaMatch, s)
+	}
+
+	// (?-i) turns off the flag given to ParseFlags.
+	p, err = ParseFlags("a(?-i)b", FoldCase)
+	assert.NoError(t, err)
+	_, match := MakeNfa(p).Match("AB")
+	assert.False(t, match)
+
+	for _, pat := range []string{"(?-)a", "(?i-i-i)a", "(?i)*", "a(?i)*"} {
+		_, err := Parse(pat)
+		assert.Error(t, err, pat)
+	}
+}
+
+func TestPCRE(t *testing.T) {
+	// outcome is the expected result of parsing a pattern and matching it.
+	type outcome struct {
+		match []int // nil if the pattern parses but doesn't match
+		err   bool  // the pattern fails to parse with code
+		code  ErrorCode
+	}
+	noMatch := outcome{}
+	tests := []struct {
+		pat    string
+		s      string
+		native outcome
+		pcre   outcome
+	}{
+		// native (?: is a capture of ":" instead.
+		{"(a)(?:b)", "ab", noMatch, outcome{match: []int{0, 2, 0, 1}}},
+		{"(?a)(b)", "ab", outcome{match: []int{0, 2, 0, 1}}, outcome{err: true, code: ErrUnexpected}},
+		// native (?P is a capture of "P<x>a".
+		{"(?P<x>a)(?<y>b)", "ab", noMatch, outcome{match: []int{0, 2, 0, 1, 1, 2}}},
+		{"((?i)a)(?i:b)", "AB", outcome{match: []int{0, 2}}, outcome{match: []int{0, 2, 0, 1}}},
+		{"(?:a|b)+", "ab", noMatch, outcome{match: []int{0, 2}}},
+	}
+
+	for _, test := range tests {
+		for _, flags := range []Flags{0, PCRE} {
+			want := test.native
+			if flags == PCRE {
+				want = test.pcre
+			}
+
+			p, err := ParseFlags(test.pat, flags)
+			if want.err {
+				var perr *ParseError
+				assert.True(t, errors.As(err, &perr), "%q %v %v", test.pat, flags, err)
+				assert.Equal(t, perr.Code, want.code, "%q %v", test.pat, flags)
+				continue
+			}
+			assert.NoError(t, err, "%q %v", test.pat, flags)
+			assert.Equal(t, MakeNfa(p).SubmatchIndex(test.s), want.match, "%q %v", test.pat, flags)
+		}
+	}
+
+	p, err := ParseFlags("(?<k>\\w+)=(\\w+)", PCRE)
+	assert.NoError(t, err)
+	assert.Equal(t, []string(p.groupNames()), []string{"", "k", ""})
+
+	for _, pat := range []string{"(?a)", "(?P)", "(?Px>a)", "(?#a)"} {
+		_, err := ParseFlags(pat, PCRE)
+		assert.Error(t, err, pat)
+	}
+}
+
+func TestRepeatLimits(t *testing.T) {
+	for _, pat := range []string{"a{", "a{}", "a{,3}", "a{3", "a{3,2}", "{3}", "{", "[{]", "a{1,100000}", "(a{100}){1000}"} {
+		_, err := Parse(pat)
+		assert.Error(t, err, pat)
+	}
+
+	p, err := Parse("(a{100}){100}")
+	assert.NoError(t, err)
+	assert.Equal(t, p.size(), 100*100)
+}
+
+func TestFind(t *testing.T) {
+	finders := []struct {
+		name string
+		make func(pat string) (Finder, error)
+	}{
+		{"nfa-find", func(pat string) (Finder, error) { return NewNfa(pat) }},
+		{"dfa-find", func(pat string) (Finder, error) { return NewDfa(pat) }},
+		{"dfa-table-find", func(pat string) (Finder, error) {
+			dfa, err := NewDfa(pat)
+			if err != nil {
+				return nil, err
+			}
+			return dfa.Compile(), nil
+		}},
+		{"lazy-dfa-find", func(pat string) (Finder, error) { return NewLazyDfa(pat) }},
+	}
+
+	tests := []struct {
+		pat  string
+		s    string
+		want []int
+	}{
+		{"b+", "aabbbcc", []int{2, 5}},
+		{"b*", "aabbbcc", []int{0, 0}},
+		{"x", "aabbbcc", nil},
+		{"^a", "aab", []int{0, 1}},
+		{"^b", "aab", nil},
+		{"b$", "aab", []int{2, 3}},
+		{"a$", "aab", nil},
+		{"^$", "", []int{0, 0}},
+		{"$", "abc", []int{3, 3}},
+		{"ab|abcd", "xxabcde", []int{2, 6}},
+		{"(ab|c)+", "xcabcx", []int{1, 5}},
+		{"é+", "aéébc", []int{1, 5}},
+		{"error: [0-9]{3}", "ok\nerror: 404 not found", []int{3, 13}},
+		{"abcd|bc", "abcd", []int{0, 4}},
+		{"bc|abcd", "xabcd", []int{1, 5}},
+		{"a.*b|c", "xacbc", []int{1, 4}},
+		{"c|a.*b", "xacbc", []int{1, 4}},
+		// a failing search reads the input once, not once per start offset.
+		{"a*c", strings.Repeat("a", 100000), nil},
+		{"a*c", strings.Repeat("a", 100000) + "c", []int{0, 100001}},
+	}
+
+	for _, f := range finders {
+		for _, test := range tests {
+			mach, err := f.make(test.pat)
+			assert.NoError(t, err)
+			assert.Equal(t, mach.FindIndex(test.s), test.want, "%s %q %q", f.name, test.pat, test.s)
 		}
 	}
 }
@@ -0,0 +1,81 @@
+package tre
+
+import (
+	"unicode/utf8"
+)
+
+// searcher is a matching machine with states of type S that findLongest
+// runs over its input. The add functions add a state to the states at the
+// next position, and return false if it was already added.
+type searcher[S comparable] interface {
+	// start adds the start states for a match that starts at a position
+	// where the assertions in at hold.
+	start(at anchors, add func(S) bool)
+	// step adds the states reached from st on ch.
+	step(st S, ch rune, add func(S) bool)
+	// accepting returns true if st accepts at a position where the assertions in at hold.
+	accepting(st S, at anchors) bool
+}
+
+// run is a state of a search, with the byte offset where its match started.
+type run[S comparable] struct {
+	st    S
+	start int
+}
+
+// findLongest returns the byte offsets of the leftmost longest match of m
+// in s, or nil if there is no match. It reads s once, as if m had an implicit
+// ".*?" prefix: a match is started at every position until one is found, and
+// runs that reach the same state keep only the earliest start, which has the
+// same future. Once a match is found, only runs starting at or before it
+// are followed, to find a match further left or a longer one.
+func findLongest[S comparable](m searcher[S], s string) []int {
+	var runs []run[S]
+	seen := make(map[S]struct{})
+	adder := func(start int) func(S) bool {
+		return func(st S) bool {
+			if _, ok := seen[st]; ok {
+				return false
+			}
+			seen[st] = struct{}{}
+			runs = append(runs, run[S]{st, start})
+			return true
+		}
+	}
+
+	matchStart, matchEnd := -1, -1
+	for pos := 0; ; {
+		at := anchorsAt(s, pos)
+		if matchStart < 0 {
+			m.start(at, adder(pos))
+		}
+
+		live := runs[:0]
+		for _, r := range runs {
+			if m.accepting(r.st, at) && (matchStart < 0 || r.start <= matchStart) {
+				matchStart, matchEnd = r.start, pos
+			}
+		}
+		for _, r := range runs {
+			if matchStart < 0 || r.start <= matchStart {
+				live = append(live, r)
+			}
+		}
+		if pos == len(s) || (matchStart >= 0 && len(live) == 0) {
+			break
+		}
+
+		ch, w := utf8.DecodeRuneInString(s[pos:])
+		runs = nil
+		clear(seen)
+		for _, r := range live {
+			m.step(r.st, ch, adder(r.start))
+		}
+		pos += w
+	}
+
+	if matchStart < 0 {
+		return nil
+	}
+	return []int{matchStart, matchEnd}
+}
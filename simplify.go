@@ -0,0 +1,189 @@
+package tre
+
+import (
+	"slices"
+)
+
+// Simplify returns a copy of p that matches the same strings with the same
+// captures and preferences, but builds a smaller NFA. It folds nested
+// repetitions such as "a**", merges alternatives of single classes such as
+// "a|[bc]" into one class, removes duplicate alternatives without captures,
+// and factors the common leading classes out of alternatives, so that
+// "abc|abd" becomes "ab[cd]". Only adjacent alternatives are merged or
+// factored, because reordering alternatives changes which one is preferred.
+// NewNfa simplifies the expressions it parses.
+func Simplify(p *Parsed) *Parsed {
+	return renumber(simplify(p))
+}
+
+func simplify(p *Parsed) *Parsed {
+	switch p.typ {
+	case ParseConcat:
+		return &Parsed{typ: ParseConcat, left: simplify(p.left), right: simplify(p.right)}
+	case ParseAlt:
+		var alts []*Parsed
+		for _, alt := range alternatives(p) {
+			alts = append(alts, simplify(alt))
+		}
+		return simplifyAlts(alts)
+	case ParseStar, ParsePlus, ParseOpt:
+		q := *p
+		q.left = simplify(p.left)
+		return foldRepetition(&q)
+	case ParseRepeat, ParseCap:
+		q := *p
+		q.left = simplify(p.left)
+		return &q
+	default:
+		return p
+	}
+}
+
+// foldRepetition folds a star, plus or optional p of another one with the same
+// laziness into a single repetition. "x**", "x+*", "x?*", "x*+", "(x*)?", "x?+"
+// and "(x+)?" all match like "x*", "x++" like "x+", and "(x?)?" like "x?".
+// Repetitions of an x that matches the empty string are kept, because the
+// preferred match of nested empty repetitions depends on their nesting.
+func foldRepetition(p *Parsed) *Parsed {
+	for {
+		left := p.left
+		switch left.typ {
+		case ParseStar, ParsePlus, ParseOpt:
+		default:
+			return p
+		}
+		if left.lazy != p.lazy || matchesEmpty(left.left) {
+			return p
+		}
+
+		typ := ParseStar
+		if p.typ == left.typ {
+			typ = p.typ
+		}
+		p = &Parsed{typ: typ, left: left.left, lazy: p.lazy}
+	}
+}
+
+// matchesEmpty returns true if p can match without consuming any characters.
+func matchesEmpty(p *Parsed) bool {
+	switch p.typ {
+	case ParseBegin, ParseEnd, ParseStar, ParseOpt:
+		return true
+	case ParseConcat:
+		return matchesEmpty(p.left) && matchesEmpty(p.right)
+	case ParseAlt:
+		return matchesEmpty(p.left) || matchesEmpty(p.right)
+	case ParseRepeat:
+		return p.min == 0 || matchesEmpty(p.left)
+	case ParsePlus, ParseCap:
+		return matchesEmpty(p.left)
+	default:
+		return false
+	}
+}
+
+// alternatives returns the alternatives of p in order of preference.
+func alternatives(p *Parsed) []*Parsed {
+	if p.typ != ParseAlt {
+		return []*Parsed{p}
+	}
+	return append(alternatives(p.left), alternatives(p.right)...)
+}
+
+// concatenation returns the items of p in order.
+func concatenation(p *Parsed) []*Parsed {
+	if p.typ != ParseConcat {
+		return []*Parsed{p}
+	}
+	return append(concatenation(p.left), concatenation(p.right)...)
+}
+
+// hasCaps returns true if p contains a capture group.
+func hasCaps(p *Parsed) bool {
+	found := false
+	Walk(p, func(p *Parsed) bool {
+		found = found || p.typ == ParseCap
+		return !found
+	})
+	return found
+}
+
+// simplifyAlts returns the alternation of the simplified alternatives alts.
+func simplifyAlts(alts []*Parsed) *Parsed {
+	// a later duplicate is never preferred over an earlier one.
+	// Duplicates with captures are kept for their group numbers.
+	seen := make(map[string]struct{})
+	var unique []*Parsed
+	for _, alt := range alts {
+		if !hasCaps(alt) {
+			key := alt.String()
+			if _, ok := seen[key]; ok {
+				continue
+			}
+			seen[key] = struct{}{}
+		}
+		unique = append(unique, alt)
+	}
+
+	alts = nil
+	for idx := 0; idx < len(unique); {
+		n, prefix := commonPrefix(unique[idx:])
+		if prefix == 0 {
+			alts = append(alts, unique[idx])
+			idx++
+			continue
+		}
+
+		items := concatenation(unique[idx])[:prefix]
+		var rests []*Parsed
+		for _, alt := range unique[idx : idx+n] {
+			rests = append(rests, joinRight(ParseConcat, concatenation(alt)[prefix:]))
+		}
+		alts = append(alts, joinRight(ParseConcat, append(slices.Clone(items), simplifyAlts(rests))))
+		idx += n
+	}
+
+	// single classes only match one character, so they match like their union.
+	var merged []*Parsed
+	for _, alt := range alts {
+		if last := len(merged) - 1; last >= 0 && alt.typ == ParseClass && merged[last].typ == ParseClass {
+			class := slices.Clone(merged[last].class)
+			class.AddRanges(alt.class)
+			merged[last] = &Parsed{typ: ParseClass, class: class, caps: alt.caps}
+			continue
+		}
+		merged = append(merged, alt)
+	}
+	return joinRight(ParseAlt, merged)
+}
+
+// commonPrefix returns how many of the leading alternatives in alts start
+// with the same classes, and how many classes they have in common.
+// Each alternative keeps at least one item after the prefix.
+// It returns a prefix of 0 if fewer than two alternatives share a class.
+func commonPrefix(alts []*Parsed) (int, int) {
+	first := concatenation(alts[0])
+	prefix := len(first) - 1
+	n := 1
+	for _, alt := range alts[1:] {
+		items := concatenation(alt)
+		common := 0
+		for common < min(prefix, len(items)-1) && sameClass(first[common], items[common]) {
+			common++
+		}
+		if common == 0 {
+			break
+		}
+		prefix = common
+		n++
+	}
+	if n < 2 {
+		return 1, 0
+	}
+	return n, prefix
+}
+
+// sameClass returns true if p and q are classes with the same characters.
+func sameClass(p, q *Parsed) bool {
+	return p.typ == ParseClass && q.typ == ParseClass && slices.Equal(p.class, q.class)
+}
@@ -0,0 +1,108 @@
+package tre
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/alecthomas/assert"
+)
+
+func TestSimplify(t *testing.T) {
+	tests := []struct {
+		pat  string
+		want string
+	}{
+		{"a**", "a*"},
+		{"a+*", "a*"},
+		{"(a?)*", "a*"},
+		{"a*+", "a*"},
+		{"(a*)?", "a*"},
+		{"a++", "a+"},
+		{"(a?)?", "a?"},
+		{"(a+)?", "a*"},
+		{"(a*?)*?", "a*?"},
+		{"(a+?)?", "a+??"},
+		{"(a*?)*", "a*?*"},
+		{"(a*)*?", "a**?"},
+		{"(a?)+", "a*"},
+		{"(a|b*)*", "(a|b*)*"},
+		{"a|a", "a"},
+		{"[a]|[b]", "[ab]"},
+		{"a|[b-d]|e", "[a-e]"},
+		{"a|bc|d", "a|bc|d"},
+		{"ab|cd|ab", "ab|cd"},
+		{"(?a)|(?a)", "(?a)|(?a)"},
+		{"abc|abd", "ab[cd]"},
+		{"abc|abd|ax|b", "a(b[cd]|x)|b"},
+		{"ab|abc", "a(b|bc)"},
+		{"abc|abcd", "ab(c|cd)"},
+		{"hello|help", "hel(lo|p)"},
+		{"x(?ab|ac)y", "x(?a[bc])y"},
+		{"(?<n>a|b)*|c", "(?<n>[ab])*|c"},
+		{"(a|b)|(c|d)", "[a-d]"},
+		{"a{2}|a{2}", "a{2}"},
+		{"(a|a)**{2}", "a*{2}"},
+	}
+
+	for _, test := range tests {
+		p, err := Parse(test.pat)
+		assert.NoError(t, err)
+		orig := p.String()
+		assert.Equal(t, Simplify(p).String(), test.want, test.pat)
+		assert.Equal(t, p.String(), orig, "p is not modified")
+	}
+}
+
+func TestSimplifySize(t *testing.T) {
+	p, err := Parse("(a|a)**|[a]|[b]")
+	assert.NoError(t, err)
+	assert.True(t, Simplify(p).size() < p.size())
+}
+
+// expectSimplifyEquivalent checks that pat and its simplification match
+// the same strings in s with the same captures.
+func expectSimplifyEquivalent(t *testing.T, pat string, strs []string) {
+	p, err := Parse(pat)
+	assert.NoError(t, err)
+	simple := Simplify(p)
+	nfa, nfa2 := MakeNfa(p), MakeNfa(simple)
+	assert.Equal(t, nfa2.SubexpNames(), nfa.SubexpNames(), pat)
+
+	for _, s := range strs {
+		assert.Equal(t, nfa2.SubmatchIndex(s), nfa.SubmatchIndex(s), "%q %q %q", pat, simple, s)
+		assert.Equal(t, nfa2.FindSubmatchIndex(s), nfa.FindSubmatchIndex(s), "%q %q %q", pat, simple, s)
+		assert.Equal(t, nfa2.FindIndex(s), nfa.FindIndex(s), "%q %q %q", pat, simple, s)
+
+		groups2, ok2 := nfa2.Match(s)
+		groups, ok := nfa.Match(s)
+		assert.Equal(t, ok2, ok, "%q %q %q", pat, simple, s)
+		assert.Equal(t, groups2, groups, "%q %q %q", pat, simple, s)
+	}
+}
+
+func TestSimplifyEquivalent(t *testing.T) {
+	pats := []string{
+		"(?a*)**",
+		"((?a?)*)*b",
+		"(?a|ab)(?c|bcd)(?d*)",
+		"(?abc|abd|ab)(?c)?",
+		"(?a|(?b)|a|(?b))+",
+		"(?x*?)*?(?x*)",
+		"hello|help|hel",
+	}
+	for _, pat := range pats {
+		expectSimplifyEquivalent(t, pat, allStrings("abcdx", 4))
+	}
+}
+
+func TestSimplifyRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	strs := allStrings("abc", 4)
+	for range 20000 {
+		pat := randomString(r, "aabbc()(?|||*+?", 1+r.Intn(12))
+		if _, err := Parse(pat); err != nil {
+			continue
+		}
+		expectSimplifyEquivalent(t, pat, strs)
+	}
+}
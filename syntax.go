@@ -0,0 +1,139 @@
+package tre
+
+import (
+	"fmt"
+	"regexp/syntax"
+	"unicode"
+)
+
+// UnsupportedError reports a part of a regexp/syntax expression
+// that has no equivalent in tre.
+type UnsupportedError struct {
+	Feature string // what is not supported
+	Expr    string // the subexpression using it, in RE2 syntax
+}
+
+func (e *UnsupportedError) Error() string {
+	return fmt.Sprintf("unsupported %s in %q", e.Feature, e.Expr)
+}
+
+// ParseRE2 parses s in the RE2 syntax of Go's regexp package,
+// and converts it with FromSyntax.
+func ParseRE2(s string) (*Parsed, error) {
+	re, err := syntax.Parse(s, syntax.Perl)
+	if err != nil {
+		return nil, err
+	}
+	return FromSyntax(re)
+}
+
+// FromSyntax converts an expression parsed by regexp/syntax into a tree that
+// matches the same strings with the same capture groups. Multi-line anchors,
+// word boundaries, empty classes and group names that tre can't parse are
+// not supported, and return an *UnsupportedError.
+func FromSyntax(re *syntax.Regexp) (*Parsed, error) {
+	p, err := fromSyntax(re)
+	if err != nil {
+		return nil, err
+	}
+	return renumber(p), nil
+}
+
+// emptyMatch returns a node that only matches the empty string.
+func emptyMatch() *Parsed {
+	return &Parsed{typ: ParseRepeat, left: Any(), min: 0, max: 0}
+}
+
+func fromSyntax(re *syntax.Regexp) (*Parsed, error) {
+	unsupported := func(feature string) error {
+		return &UnsupportedError{Feature: feature, Expr: re.String()}
+	}
+
+	var subs []*Parsed
+	for _, sub := range re.Sub {
+		p, err := fromSyntax(sub)
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, p)
+	}
+
+	var p *Parsed
+	switch re.Op {
+	case syntax.OpEmptyMatch:
+		return emptyMatch(), nil
+	case syntax.OpLiteral:
+		var items []*Parsed
+		for _, ch := range re.Rune {
+			class := newRange1(ch)
+			if re.Flags&syntax.FoldCase != 0 {
+				class = class.FoldCase()
+			}
+			items = append(items, &Parsed{typ: ParseClass, class: class})
+		}
+		if len(items) == 0 {
+			return emptyMatch(), nil
+		}
+		return joinRight(ParseConcat, items), nil
+	case syntax.OpNoMatch:
+		return nil, unsupported("empty class")
+	case syntax.OpCharClass:
+		if len(re.Rune) == 0 {
+			return nil, unsupported("empty class")
+		}
+		var class Ranges
+		for idx := 0; idx+1 < len(re.Rune); idx += 2 {
+			rmax := re.Rune[idx+1]
+			if rmax == unicode.MaxRune {
+				// tre's inverted classes extend past unicode.MaxRune.
+				rmax = maxRune
+			}
+			class.Add(re.Rune[idx], rmax)
+		}
+		return &Parsed{typ: ParseClass, class: class}, nil
+	case syntax.OpAnyCharNotNL:
+		return &Parsed{typ: ParseClass, class: newRange1('\n').Invert()}, nil
+	case syntax.OpAnyChar:
+		return Any(), nil
+	case syntax.OpBeginText:
+		return Begin(), nil
+	case syntax.OpEndText:
+		return End(), nil
+	case syntax.OpCapture:
+		for idx, ch := range []rune(re.Name) {
+			if !isGroupNameRune(ch, idx == 0) {
+				return nil, unsupported("group name")
+			}
+		}
+		return &Parsed{typ: ParseCap, left: subs[0], name: re.Name}, nil
+	case syntax.OpStar:
+		p = Star(subs[0])
+	case syntax.OpPlus:
+		p = Plus(subs[0])
+	case syntax.OpQuest:
+		p = Opt(subs[0])
+	case syntax.OpRepeat:
+		p = &Parsed{typ: ParseRepeat, left: subs[0], min: re.Min, max: re.Max}
+		if p.size() > MaxExpansion {
+			return nil, unsupported(fmt.Sprintf("repetition expanding to more than %d states", MaxExpansion))
+		}
+	case syntax.OpConcat:
+		if len(subs) == 0 {
+			return emptyMatch(), nil
+		}
+		return joinRight(ParseConcat, subs), nil
+	case syntax.OpAlternate:
+		return joinRight(ParseAlt, subs), nil
+	case syntax.OpBeginLine, syntax.OpEndLine:
+		return nil, unsupported("multi-line anchor")
+	case syntax.OpWordBoundary, syntax.OpNoWordBoundary:
+		return nil, unsupported("word boundary")
+	default:
+		return nil, unsupported(re.Op.String())
+	}
+
+	if re.Flags&syntax.NonGreedy != 0 {
+		p.lazy = true
+	}
+	return p, nil
+}
@@ -0,0 +1,88 @@
+package tre
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/alecthomas/assert"
+)
+
+func TestParseRE2(t *testing.T) {
+	tests := []struct {
+		pat  string
+		want string
+	}{
+		{"abc", "abc"},
+		{"a|b|cd", "[ab]|cd"},
+		{"(a)(?:b)(?P<x>c)", "(?a)b(?<x>c)"},
+		{"a*?b+c??d{2,}?e{1,3}", "a*?b+c??d{2,}?e{1,3}"},
+		{"[a-c][^a]", "[a-c][^a]"},
+		{".", "[^\\n]"},
+		{"(?s).", "."},
+		{"^a$", "^a$"},
+		{"\\Aa\\z", "^a$"},
+		{"(?i)k", "[Kk\u212a]"},
+		{"(?i)ab", "[Aa][Bb]"},
+		{"\\d\\pL", "\\d\\pL"},
+		{"a|", "a|.{0}"},
+		{"()", "(?.{0})"},
+		{"(?U)a*", "a*?"},
+	}
+
+	for _, test := range tests {
+		p, err := ParseRE2(test.pat)
+		assert.NoError(t, err, test.pat)
+		want, err := Parse(test.want)
+		assert.NoError(t, err, test.want)
+		assert.Equal(t, p.String(), want.String(), test.pat)
+	}
+}
+
+func TestParseRE2Unsupported(t *testing.T) {
+	tests := []struct {
+		pat     string
+		feature string
+	}{
+		{"(?m)^a", "multi-line anchor"},
+		{"a(?m)$", "multi-line anchor"},
+		{"\\ba", "word boundary"},
+		{"a\\B", "word boundary"},
+		{"[^\\x00-\\x{10FFFF}]", "empty class"},
+		{"(?P<1x>a)", "group name"},
+		{"(?:abcdefghijk){1000}", "repetition expanding to more than 10000 states"},
+	}
+
+	for _, test := range tests {
+		p, err := ParseRE2(test.pat)
+		assert.Zero(t, p, test.pat)
+		var uerr *UnsupportedError
+		assert.True(t, errors.As(err, &uerr), "%q %v", test.pat, err)
+		assert.Equal(t, uerr.Feature, test.feature, test.pat)
+	}
+
+	_, err := ParseRE2("a(")
+	assert.Error(t, err)
+}
+
+func TestParseRE2Match(t *testing.T) {
+	pats := []string{
+		"(a|ab)(c|bcd)(d*)",
+		"(a*?)(a*)b",
+		"x(?P<n>[a-c]+)?d",
+		"^(a{1,2})(b|c)*$",
+		"(?i)(AB|c)+",
+		"(a+|b)*?c",
+		"[^a]*(b|.)",
+	}
+	for _, pat := range pats {
+		p, err := ParseRE2(pat)
+		assert.NoError(t, err, pat)
+		nfa := MakeNfa(p)
+		re := regexp.MustCompile(pat)
+		assert.Equal(t, nfa.SubexpNames(), re.SubexpNames(), pat)
+		for _, s := range allStrings("abcdxA\n", 4) {
+			assert.Equal(t, nfa.FindSubmatchIndex(s), re.FindStringSubmatchIndex(s), "%q %q", pat, s)
+		}
+	}
+}
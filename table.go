@@ -0,0 +1,179 @@
+package tre
+
+import (
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// classRange maps the runes of a non-ASCII range to an equivalence class.
+type classRange struct {
+	Range
+	class int32
+}
+
+// DfaTable is a compiled form of a Dfa for fast matching.
+// Runes are mapped to equivalence classes, such that all runes in a class
+// lead every state to the same next state, and transitions are stored
+// in a dense table indexed by state and class.
+// Class 0 holds the runes that no state has an edge for.
+// Tag operations of tagged DFAs are not compiled.
+type DfaTable struct {
+	ascii    [utf8.RuneSelf]int32 // class of each ASCII rune
+	ranges   []classRange         // classes of non-ASCII runes, in sorted order
+	nclasses int
+
+	trans     []int32 // trans[state*nclasses+class] is the next state, or -1
+	accept    []bool
+	acceptMid []bool
+	caps      [][]int
+	start     int32
+	midStart  int32
+
+	groupNames
+}
+
+// Compile builds a DfaTable from d.
+func (d *Dfa) Compile() *DfaTable {
+	states := d.states()
+	ids := make(map[*dfaState]int32)
+	for id, s := range states {
+		ids[s] = int32(id)
+	}
+
+	var edgeClasses []Ranges
+	for _, s := range states {
+		for _, edge := range s.edges {
+			edgeClasses = append(edgeClasses, edge.class.ranges)
+		}
+	}
+	classes := disjointRanges(edgeClasses)
+
+	t := &DfaTable{nclasses: len(classes) + 1, groupNames: d.groupNames}
+	for idx, class := range classes {
+		id := int32(idx + 1)
+		for _, r := range class {
+			for ch := r.rmin; ch <= r.rmax && ch < utf8.RuneSelf; ch++ {
+				t.ascii[ch] = id
+			}
+			if r.rmax >= utf8.RuneSelf {
+				t.ranges = append(t.ranges, classRange{Range{max(r.rmin, utf8.RuneSelf), r.rmax}, id})
+			}
+		}
+	}
+	slices.SortFunc(t.ranges, func(a, b classRange) int {
+		return int(a.rmin - b.rmin)
+	})
+
+	t.trans = make([]int32, len(states)*t.nclasses)
+	for id, s := range states {
+		row := t.trans[id*t.nclasses : (id+1)*t.nclasses]
+		row[0] = -1
+		for idx, class := range classes {
+			row[idx+1] = -1
+			if next := matchChar(s, class[0].rmin); next != nil {
+				row[idx+1] = ids[next]
+			}
+		}
+		t.accept = append(t.accept, s.accept)
+		t.acceptMid = append(t.acceptMid, s.acceptMid)
+		t.caps = append(t.caps, s.caps)
+	}
+
+	t.start = ids[d.start]
+	t.midStart = ids[d.midStart]
+	return t
+}
+
+// classOf returns the equivalence class of ch.
+func (t *DfaTable) classOf(ch rune) int32 {
+	if 0 <= ch && ch < utf8.RuneSelf {
+		return t.ascii[ch]
+	}
+
+	idx, found := slices.BinarySearchFunc(t.ranges, ch, func(r classRange, ch rune) int {
+		switch {
+		case r.rmax < ch:
+			return -1
+		case ch < r.rmin:
+			return 1
+		default:
+			return 0
+		}
+	})
+	if !found {
+		return 0
+	}
+	return t.ranges[idx].class
+}
+
+func (t *DfaTable) next(state int32, ch rune) int32 {
+	return t.trans[int(state)*t.nclasses+int(t.classOf(ch))]
+}
+
+// tableSearch runs a DfaTable in findLongest.
+type tableSearch struct {
+	t *DfaTable
+}
+
+func (ts tableSearch) start(at anchors, add func(int32) bool) {
+	if at&atBegin != 0 {
+		add(ts.t.start)
+	} else {
+		add(ts.t.midStart)
+	}
+}
+
+func (ts tableSearch) step(state int32, ch rune, add func(int32) bool) {
+	if next := ts.t.next(state, ch); next >= 0 {
+		add(next)
+	}
+}
+
+func (ts tableSearch) accepting(state int32, at anchors) bool {
+	if at&atEnd != 0 {
+		return ts.t.accept[state]
+	}
+	return ts.t.acceptMid[state]
+}
+
+// FindIndex returns the byte offsets of the leftmost longest match of t in s,
+// or nil if there is no match. The match need not cover all of s.
+func (t *DfaTable) FindIndex(s string) []int {
+	return findLongest(tableSearch{t}, s)
+}
+
+func (t *DfaTable) Match(s string) ([]string, bool) {
+	capGroups := make(map[int]*strings.Builder)
+	maxGroup := 0
+	state := t.start
+	for _, ch := range s {
+		state = t.next(state, ch)
+		if state < 0 {
+			return nil, false
+		}
+
+		for _, capIdx := range t.caps[state] {
+			if _, ok := capGroups[capIdx]; !ok {
+				if capIdx > maxGroup {
+					maxGroup = capIdx
+				}
+				capGroups[capIdx] = &strings.Builder{}
+			}
+			capGroups[capIdx].WriteRune(ch)
+		}
+	}
+
+	if !t.accept[state] {
+		return nil, false
+	}
+
+	var groups []string
+	if maxGroup > 0 {
+		groups = make([]string, maxGroup)
+		for n, g := range capGroups {
+			groups[n-1] = g.String()
+		}
+	}
+	return groups, true
+}
@@ -0,0 +1,75 @@
+package tre
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/assert"
+)
+
+func TestDfaTable(t *testing.T) {
+	pats := []string{
+		"(a|b)*a(a|b){3}",
+		"a(?b*)c|ab",
+		"^ab|b+$",
+		"[a-c]*[b-d]+",
+		"x(?[a-z]+)y",
+	}
+
+	r := rand.New(rand.NewSource(1))
+	for _, pat := range pats {
+		dfa, err := NewDfa(pat)
+		assert.NoError(t, err)
+		table := dfa.Compile()
+		for range 200 {
+			s := randomString(r, "abcdxy", r.Intn(12))
+			wantGroups, want := dfa.Match(s)
+			groups, got := table.Match(s)
+			assert.Equal(t, got, want, "%q %q", pat, s)
+			assert.Equal(t, groups, wantGroups, "%q %q", pat, s)
+			assert.Equal(t, table.FindIndex(s), dfa.FindIndex(s), "%q %q", pat, s)
+		}
+	}
+}
+
+func TestDfaTableClasses(t *testing.T) {
+	dfa, err := NewDfa("[a-z]+é|[m-zé-ü]+")
+	assert.NoError(t, err)
+	table := dfa.Compile()
+
+	// [a-l] [m-z] é [ê-ü] and the runes outside of every edge.
+	assert.Equal(t, table.nclasses, 5)
+	assert.Equal(t, table.classOf('a'), table.classOf('l'))
+	assert.NotEqual(t, table.classOf('a'), table.classOf('m'))
+	assert.Equal(t, table.classOf('ê'), table.classOf('ü'))
+	assert.Equal(t, table.classOf('0'), int32(0))
+	assert.Equal(t, table.classOf('ÿ'), int32(0))
+	assert.Equal(t, table.classOf('世'), int32(0))
+
+	for _, s := range []string{"abcé", "mnéü", "xyz", "aé", "é", "abc", "ÿ"} {
+		_, want := dfa.Match(s)
+		_, got := table.Match(s)
+		assert.Equal(t, got, want, "%q", s)
+	}
+}
+
+func BenchmarkDfaMatch(b *testing.B) {
+	dfa, err := NewDfa("[a-z]*(é|[0-9]+|[A-Za-z_]+)*x")
+	if err != nil {
+		b.Fatal(err)
+	}
+	s := strings.Repeat("abcé123XYZ_", 1000) + "x"
+
+	b.Run("dfa", func(b *testing.B) {
+		for b.Loop() {
+			dfa.Match(s)
+		}
+	})
+	b.Run("table", func(b *testing.B) {
+		table := dfa.Compile()
+		for b.Loop() {
+			table.Match(s)
+		}
+	})
+}
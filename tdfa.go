@@ -0,0 +1,262 @@
+package tre
+
+import (
+	"fmt"
+	"slices"
+	"unicode/utf8"
+)
+
+// A tagged DFA tracks capture positions in registers while matching.
+// Each tagged DFA state is an ordered list of NFA states, called items,
+// in the priority order of a Pike VM thread list, and each item has its
+// own registers holding one position per capture slot. Transitions carry
+// tag operations that build the registers of the next state's items from
+// the registers of the current state's items.
+
+// tagOp builds the registers of one item: the registers of item from in the
+// previous state are copied, and then the slots in set are set to the current
+// position. From is -1 if there is no previous state.
+type tagOp struct {
+	from int
+	set  []int
+}
+
+func (op tagOp) String() string {
+	return fmt.Sprintf("%d%v", op.from, op.set)
+}
+
+func eqTagOps(a, b []tagOp) bool {
+	return slices.EqualFunc(a, b, func(x, y tagOp) bool {
+		return x.from == y.from && slices.Equal(x.set, y.set)
+	})
+}
+
+// tags holds the register information of a tagged DFA state.
+type tags struct {
+	nslots   int     // slots per item
+	init     []tagOp // start states only, registers at the start of a match
+	final    int     // item whose registers are used at the end of input, or -1
+	finalSet []int   // slots set to the end position for the final item
+}
+
+// taggedItem is an item reached by a transition, with the tag operation that builds its registers.
+type taggedItem struct {
+	n  *nfaState
+	op tagOp
+}
+
+// addTagged adds an item for n to l in priority order like addThread,
+// but records which slots are set on the way instead of their values.
+// End assertions that don't hold in at are kept as pending items.
+func addTagged(l []taggedItem, n *nfaState, at anchors, op tagOp, visited map[*nfaState]struct{}) []taggedItem {
+	if _, ok := visited[n]; ok {
+		return l
+	}
+	visited[n] = struct{}{}
+
+	switch {
+	case n.split:
+		l = addTagged(l, n.next1, at, op, visited)
+		l = addTagged(l, n.next2, at, op, visited)
+	case n.begin:
+		if at&atBegin != 0 {
+			l = addTagged(l, n.next1, at, op, visited)
+		}
+	case n.end && at&atEnd != 0:
+		l = addTagged(l, n.next1, at, op, visited)
+	case n.save:
+		op.set = append(slices.Clone(op.set), n.slot)
+		l = addTagged(l, n.next1, at, op, visited)
+	default: // accepting states, character consuming states, and pending end assertions.
+		l = append(l, taggedItem{n, op})
+	}
+	return l
+}
+
+// finalItem returns the highest priority item that accepts at the end of input,
+// and the slots set on its way to the accepting state, or -1 if there is none.
+func finalItem(items []*nfaState, at anchors) (int, []int) {
+	for k, n := range items {
+		switch {
+		case n.accept:
+			return k, nil
+		case n.end:
+			// the pending assertion holds now that the input has ended.
+			for _, item := range addTagged(nil, n.next1, at|atEnd, tagOp{}, make(map[*nfaState]struct{})) {
+				if item.n.accept {
+					return k, item.op.set
+				}
+			}
+		}
+	}
+	return -1, nil
+}
+
+func taggedSetKey(items []*nfaState, t *tags) string {
+	return nfaSetKey(items, append([]int{t.final}, t.finalSet...), false)
+}
+
+// addTaggedSet finds the state for the items in sets, or adds a new state for them.
+// The assertions in at hold at the position where the items are reached.
+// It returns the state, and true if the state already existed, and false if it was newly created.
+func addTaggedSet(sets nfaSets, items []*nfaState, nslots int, at anchors) (*dfaState, bool) {
+	dfa := newTaggedState(items, nslots, at)
+	key := taggedSetKey(items, dfa.tags)
+	if state, ok := sets[key]; ok {
+		return state, true
+	}
+
+	sets[key] = dfa
+	return dfa, false
+}
+
+func newTaggedState(items []*nfaState, nslots int, at anchors) *dfaState {
+	final, finalSet := finalItem(items, at)
+	return &dfaState{
+		accept:    final >= 0,
+		acceptMid: accepts(items),
+		tags:      &tags{nslots: nslots, final: final, finalSet: finalSet},
+	}
+}
+
+func splitItems(l []taggedItem) ([]*nfaState, []tagOp) {
+	var items []*nfaState
+	var ops []tagOp
+	for _, item := range l {
+		items = append(items, item.n)
+		ops = append(ops, item.op)
+	}
+	return items, ops
+}
+
+// MakeTaggedDfa builds a tagged DFA from n, which reports the same capture
+// positions as n.SubmatchIndex in linear time.
+func MakeTaggedDfa(n *Nfa) *Dfa {
+	nslots := n.start.numSlots()
+	states := make(nfaSets)
+
+	addEdge := func(d *dfaState, class Ranges, targ *dfaState, ops []tagOp) {
+		for n := range d.edges {
+			// if we already have an edge to targ with the same tag operations
+			// just augment its class with the new class.
+			if d.edges[n].next == targ && eqTagOps(d.edges[n].ops, ops) {
+				d.edges[n].class = d.edges[n].class.Union(class)
+				return
+			}
+		}
+		d.edges = append(d.edges, Edge{class: NewClass(class), next: targ, ops: ops})
+	}
+
+	// states are explored in breadth first order.
+	type work struct {
+		d     *dfaState
+		items []*nfaState
+	}
+	var queue []work
+
+	// start states are always new, because their init operations
+	// only apply at the start of a match. Edges can still lead into them.
+	start := func(at anchors) *dfaState {
+		items, init := splitItems(addTagged(nil, n.start, at, tagOp{from: -1}, make(map[*nfaState]struct{})))
+		d := newTaggedState(items, nslots, at)
+		d.tags.init = init
+		states[taggedSetKey(items, d.tags)] = d
+		queue = append(queue, work{d, items})
+		return d
+	}
+
+	dfa := &Dfa{groupNames: n.groupNames}
+	dfa.start = start(atBegin)
+	dfa.midStart = start(0)
+
+	for len(queue) > 0 {
+		d, items := queue[0].d, queue[0].items
+		queue = queue[1:]
+
+		for _, class := range disjointClasses(items) {
+			ch := class[0].rmin // exemplary char. the rest should flow the same way.
+			visited := make(map[*nfaState]struct{})
+			var l []taggedItem
+			for k, item := range items {
+				if !item.accept && !item.end && item.class.Contains(ch) {
+					l = addTagged(l, item.next1, 0, tagOp{from: k}, visited)
+				}
+			}
+			if len(l) == 0 {
+				continue
+			}
+
+			items2, ops := splitItems(l)
+			dtarg, found := addTaggedSet(states, items2, nslots, 0)
+			addEdge(d, class, dtarg, ops)
+			if !found {
+				queue = append(queue, work{dtarg, items2})
+			}
+		}
+	}
+
+	numberDfa(dfa)
+	return dfa
+}
+
+func NewTaggedDfa(re string) (*Dfa, error) {
+	nfa, err := NewNfa(re)
+	if err != nil {
+		return nil, err
+	}
+	return MakeTaggedDfa(nfa), nil
+}
+
+// applyOps builds the registers for the next state into regs from the registers in prev.
+func applyOps(regs, prev []int, ops []tagOp, nslots, pos int) []int {
+	regs = slices.Grow(regs[:0], len(ops)*nslots)[:len(ops)*nslots]
+	for k, op := range ops {
+		r := regs[k*nslots : (k+1)*nslots]
+		if op.from < 0 {
+			for i := range r {
+				r[i] = -1
+			}
+		} else {
+			copy(r, prev[op.from*nslots:(op.from+1)*nslots])
+		}
+		for _, slot := range op.set {
+			r[slot] = pos
+		}
+	}
+	return regs
+}
+
+// SubmatchIndex matches d against all of s and returns the byte offsets of
+// the match and of each capture group like Nfa.SubmatchIndex.
+// It returns nil if there is no match, or if d was not made by MakeTaggedDfa.
+func (d *Dfa) SubmatchIndex(s string) []int {
+	state := d.start
+	if state.tags == nil {
+		return nil
+	}
+
+	nslots := state.tags.nslots
+	regs := applyOps(nil, nil, state.tags.init, nslots, 0)
+	var prev []int
+	for pos := 0; pos < len(s); {
+		ch, w := utf8.DecodeRuneInString(s[pos:])
+		edge := matchEdge(state, ch)
+		if edge == nil {
+			return nil
+		}
+		pos += w
+		regs, prev = applyOps(prev, regs, edge.ops, nslots, pos), regs
+		state = edge.next
+	}
+
+	t := state.tags
+	if t.final < 0 {
+		return nil
+	}
+	match := slices.Clone(regs[t.final*nslots : (t.final+1)*nslots])
+	for _, slot := range t.finalSet {
+		match[slot] = len(s)
+	}
+	match[0], match[1] = 0, len(s)
+	return match
+}
@@ -0,0 +1,71 @@
+package tre
+
+import (
+	"testing"
+
+	"github.com/alecthomas/assert"
+)
+
+// allStrings returns every string over alphabet up to length n.
+func allStrings(alphabet string, n int) []string {
+	strs := []string{""}
+	prev := []string{""}
+	for range n {
+		var next []string
+		for _, s := range prev {
+			for _, ch := range alphabet {
+				next = append(next, s+string(ch))
+			}
+		}
+		strs = append(strs, next...)
+		prev = next
+	}
+	return strs
+}
+
+func TestTaggedDfa(t *testing.T) {
+	pats := []string{
+		"a",
+		"he(?ll)o(?a*)",
+		"(?a)*",
+		"(?a|b)+c",
+		"(?a)|(?b)",
+		"(?a(?b)*)*",
+		"(?a|ab)(?c|bcd)(?d*)",
+		"a(?a*)ab",
+		"(?a*)(?a*)",
+		"(?a*)*",
+		"(?a|b)*(?b)",
+		"(?a{1,2})(?a{1,2})",
+		"(?(?a)|b)*",
+		"^(?a*)(?b$|c)*",
+		"(?a$|ab)*",
+		"(?^a|b)+",
+		"(?a*?)(?a*)",
+		"(?a|b)+?(?b*)",
+		"(?a??)(?a{1,2}?)(?a*)",
+		"(?.*?)(?c|d)",
+	}
+
+	for _, pat := range pats {
+		nfa, err := NewNfa(pat)
+		assert.NoError(t, err)
+		dfa := MakeTaggedDfa(nfa)
+		for _, s := range allStrings("abcd", 5) {
+			assert.Equal(t, dfa.SubmatchIndex(s), nfa.SubmatchIndex(s), "%q %q", pat, s)
+		}
+	}
+}
+
+func TestTaggedDfaDiffersFromCaps(t *testing.T) {
+	// The same DFA state is reached after "ab" through both groups,
+	// so a DFA that keeps caps on states can't tell them apart.
+	dfa, err := NewTaggedDfa("(?ab)c|a(?b)d")
+	assert.NoError(t, err)
+	assert.Equal(t, dfa.SubmatchIndex("abc"), []int{0, 3, 0, 2, -1, -1})
+	assert.Equal(t, dfa.SubmatchIndex("abd"), []int{0, 3, -1, -1, 1, 2})
+	assert.Equal(t, dfa.SubmatchIndex("abe"), []int(nil))
+
+	_, match := dfa.Match("abd")
+	assert.True(t, match)
+}